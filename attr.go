@@ -0,0 +1,336 @@
+package errorx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the type of an attribute value.
+type Kind int
+
+const (
+	KindAny Kind = iota
+	KindString
+	KindInt64
+	KindFloat64
+	KindBool
+	KindDuration
+	KindTime
+)
+
+var kindNames = []string{
+	KindAny:      "any",
+	KindString:   "string",
+	KindInt64:    "int64",
+	KindFloat64:  "float64",
+	KindBool:     "bool",
+	KindDuration: "duration",
+	KindTime:     "time",
+}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "any"
+}
+
+func parseKind(s string) Kind {
+	for i, v := range kindNames {
+		if v == s {
+			return Kind(i)
+		}
+	}
+	return KindAny
+}
+
+// Attr is a typed key-value pair attached to a layer of an error.
+// Unlike header, its value keeps its type in Error(), json and reports.
+type Attr struct {
+	Key   string
+	Kind  Kind
+	Value interface{}
+}
+
+func String(key string, value string) Attr {
+	return Attr{Key: key, Kind: KindString, Value: value}
+}
+
+func Int64(key string, value int64) Attr {
+	return Attr{Key: key, Kind: KindInt64, Value: value}
+}
+
+// Int is stored as an int64.
+func Int(key string, value int) Attr {
+	return Int64(key, int64(value))
+}
+
+func Float64(key string, value float64) Attr {
+	return Attr{Key: key, Kind: KindFloat64, Value: value}
+}
+
+func Bool(key string, value bool) Attr {
+	return Attr{Key: key, Kind: KindBool, Value: value}
+}
+
+func Duration(key string, value time.Duration) Attr {
+	return Attr{Key: key, Kind: KindDuration, Value: value}
+}
+
+func Time(key string, value time.Time) Attr {
+	return Attr{Key: key, Kind: KindTime, Value: value}
+}
+
+// Any picks the kind by the type of value, values of other types are kept as KindAny.
+func Any(key string, value interface{}) Attr {
+	switch v := value.(type) {
+	case string:
+		return String(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	case bool:
+		return Bool(key, v)
+	case int:
+		return Int64(key, int64(v))
+	case int8:
+		return Int64(key, int64(v))
+	case int16:
+		return Int64(key, int64(v))
+	case int32:
+		return Int64(key, int64(v))
+	case int64:
+		return Int64(key, v)
+	case uint8:
+		return Int64(key, int64(v))
+	case uint16:
+		return Int64(key, int64(v))
+	case uint32:
+		return Int64(key, int64(v))
+	case float32:
+		return Float64(key, float64(v))
+	case float64:
+		return Float64(key, v)
+	}
+	return Attr{Key: key, Kind: KindAny, Value: value}
+}
+
+// String formats attr as 'key=value'.
+func (a Attr) String() string {
+	return a.Key + "=" + a.valueString()
+}
+
+func (a Attr) valueString() string {
+	switch a.Kind {
+	case KindString:
+		return strconv.Quote(fmt.Sprintf("%v", a.Value))
+	case KindTime:
+		if t, ok := a.Value.(time.Time); ok {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+	return fmt.Sprintf("%v", a.Value)
+}
+
+type jsonAttr struct {
+	Key   string          `json:"key"`
+	Kind  string          `json:"kind"`
+	Value json.RawMessage `json:"value"`
+}
+
+// MarshalJSON implements json.Marshaler. A duration is marshalled as a string like "1.5s", a time in RFC3339.
+//
+//	{"key": "cost", "kind": "duration", "value": "1.5s"}
+func (a Attr) MarshalJSON() ([]byte, error) {
+	var value interface{} = a.Value
+	switch v := a.Value.(type) {
+	case time.Duration:
+		value = v.String()
+	case time.Time:
+		value = v.Format(time.RFC3339Nano)
+	}
+
+	buf, er := json.Marshal(value)
+	if er != nil {
+		buf, _ = json.Marshal(fmt.Sprintf("%v", a.Value))
+	}
+	return json.Marshal(jsonAttr{
+		Key:   a.Key,
+		Kind:  a.Kind.String(),
+		Value: buf,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Values are restored into the type of their kind,
+// values of KindAny are restored as what encoding/json decodes into interface{}.
+func (a *Attr) UnmarshalJSON(buf []byte) error {
+	var tmp jsonAttr
+	if er := json.Unmarshal(buf, &tmp); er != nil {
+		return er
+	}
+	rs := Attr{Key: tmp.Key, Kind: parseKind(tmp.Kind)}
+	if len(tmp.Value) == 0 {
+		*a = rs
+		return nil
+	}
+
+	var er error
+	switch rs.Kind {
+	case KindString:
+		var v string
+		er = json.Unmarshal(tmp.Value, &v)
+		rs.Value = v
+	case KindInt64:
+		var v int64
+		er = json.Unmarshal(tmp.Value, &v)
+		rs.Value = v
+	case KindFloat64:
+		var v float64
+		er = json.Unmarshal(tmp.Value, &v)
+		rs.Value = v
+	case KindBool:
+		var v bool
+		er = json.Unmarshal(tmp.Value, &v)
+		rs.Value = v
+	case KindDuration:
+		var s string
+		if er = json.Unmarshal(tmp.Value, &s); er == nil {
+			rs.Value, er = time.ParseDuration(s)
+		}
+	case KindTime:
+		var s string
+		if er = json.Unmarshal(tmp.Value, &s); er == nil {
+			rs.Value, er = time.Parse(time.RFC3339Nano, s)
+		}
+	default:
+		var v interface{}
+		er = json.Unmarshal(tmp.Value, &v)
+		rs.Value = v
+	}
+	if er != nil {
+		return fmt.Errorf("errorx: attr '%s' of kind %s, %s", tmp.Key, tmp.Kind, er.Error())
+	}
+	*a = rs
+	return nil
+}
+
+// WrapAttrs wraps e like Wrap, and attaches attrs to the new layer.
+// Each layer keeps its own attrs, Attrs merges them.
+//
+//	return errorx.WrapAttrs(e, errorx.Int("user_id", uid), errorx.Duration("cost", time.Since(start)))
+func WrapAttrs(e error, attrs ...Attr) error {
+	if e == nil {
+		return nil
+	}
+
+	errorX, desc := wrapped(e)
+	errorX.wrapStackLine(desc)
+	errorX.stackTracesV2[0].attrs = append([]Attr(nil), attrs...)
+	return errorX
+}
+
+// Attrs returns attrs of all layers of e, see Attrs.
+func (e Error) Attrs() []Attr {
+	return Attrs(e)
+}
+
+// Attr returns the attr of key, the outer layer wins.
+func (e Error) Attr(key string) (Attr, bool) {
+	for _, v := range Attrs(e) {
+		if v.Key == key {
+			return v, true
+		}
+	}
+	return Attr{}, false
+}
+
+// Attrs merges attrs of all layers along the chain of err.
+// When a key is set at several layers, the outer one wins. Attrs are ordered from the outer layer to the inner.
+func Attrs(err error) []Attr {
+	return collectAttrs(err, true)
+}
+
+// collectAttrs merges attrs like Attrs, those rendered into descriptions by WrapContext are left out unless described.
+func collectAttrs(err error, described bool) []Attr {
+	var (
+		rs   = make([]Attr, 0, 10)
+		seen = make(map[string]bool, 0)
+	)
+	for v := err; v != nil; v = errors.Unwrap(v) {
+		x, ok := v.(Error)
+		if !ok {
+			continue
+		}
+		for _, line := range x.stackTracesV2 {
+			if line.described && !described {
+				// still shadows the same keys of inner layers
+				for _, a := range line.attrs {
+					seen[a.Key] = true
+				}
+				continue
+			}
+			rs = mergeAttrs(rs, seen, line.attrs)
+		}
+	}
+	return rs
+}
+
+// mergeAttrs appends attrs whose key is not seen to rs, in their order.
+// When a key repeats in attrs, the last one wins.
+func mergeAttrs(rs []Attr, seen map[string]bool, attrs []Attr) []Attr {
+	n := len(rs)
+	for i := len(attrs) - 1; i >= 0; i-- {
+		if seen[attrs[i].Key] {
+			continue
+		}
+		seen[attrs[i].Key] = true
+		rs = append(rs, attrs[i])
+	}
+	for i, j := n, len(rs)-1; i < j; i, j = i+1, j-1 {
+		rs[i], rs[j] = rs[j], rs[i]
+	}
+	return rs
+}
+
+// formatAttrs formats attrs one in a line.
+func formatAttrs(attrs []Attr) string {
+	var rs = make([]string, 0, len(attrs))
+	for _, v := range attrs {
+		rs = append(rs, "  "+v.String()+"\n")
+	}
+	return strings.Join(rs, "")
+}
+
+// formatPairs formats attrs as 'key=value' separated by spaces, as WrapContext describes its layer.
+func formatPairs(attrs []Attr) string {
+	var rs = make([]string, 0, len(attrs))
+	for _, v := range attrs {
+		rs = append(rs, v.pair())
+	}
+	return strings.Join(rs, " ")
+}
+
+func (a Attr) pair() string {
+	return fmt.Sprintf("%s=%v", a.Key, a.Value)
+}
+
+// sortedAttrs turns a map into attrs sorted by key.
+func sortedAttrs(m map[string]interface{}) []Attr {
+	var keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var rs = make([]Attr, 0, len(keys))
+	for _, k := range keys {
+		rs = append(rs, Any(k, m[k]))
+	}
+	return rs
+}
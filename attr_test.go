@@ -0,0 +1,161 @@
+package errorx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAny(t *testing.T) {
+	var cases = []struct {
+		value interface{}
+		kind  Kind
+	}{
+		{"ft", KindString},
+		{1, KindInt64},
+		{uint8(1), KindInt64},
+		{1.5, KindFloat64},
+		{true, KindBool},
+		{time.Second, KindDuration},
+		{time.Now(), KindTime},
+		{[]int{1}, KindAny},
+	}
+	for _, v := range cases {
+		if a := Any("k", v.value); a.Kind != v.kind {
+			fmt.Println(v.value, a.Kind)
+			t.Fail()
+			return
+		}
+	}
+}
+
+func TestWrapAttrs(t *testing.T) {
+	e := WrapAttrs(errors.New("nil return"), Int("user_id", 1), String("tenant", "a"))
+	e = WrapAttrs(e, Int("user_id", 2), Bool("retry", true))
+	e = WrapContext(e, map[string]interface{}{"api": "/user/info"})
+
+	x := e.(Error)
+	var keys = make([]string, 0, 4)
+	for _, v := range x.Attrs() {
+		keys = append(keys, v.String())
+	}
+	if strings.Join(keys, " ") != `api="/user/info" user_id=2 retry=true tenant="a"` {
+		fmt.Println(keys)
+		t.Fail()
+		return
+	}
+	if a, ok := x.Attr("user_id"); !ok || a.Value != int64(2) {
+		fmt.Println(a)
+		t.Fail()
+		return
+	}
+	// api is in the stack line of WrapContext, and not repeated in attrs
+	if !strings.Contains(x.Error(), "attrs:\n  user_id=2\n") || strings.Count(x.Error(), "/user/info") != 1 {
+		fmt.Println(x.Error())
+		t.Fail()
+		return
+	}
+
+	// attrs along the chain of remote errors
+	rs := chainRemote("user-service", x)
+	if a, ok := rs.Attr("tenant"); !ok || a.Value != "a" {
+		fmt.Println(rs.Attrs())
+		t.Fail()
+		return
+	}
+}
+
+func TestAttrJSON(t *testing.T) {
+	now := time.Now()
+	e := WrapAttrs(NewFromString("nil return"),
+		String("s", "ft"),
+		Int64("i", 1<<60),
+		Float64("f", 1.5),
+		Bool("b", true),
+		Duration("d", 1500*time.Millisecond),
+		Time("t", now),
+		Any("a", map[string]int{"x": 1}),
+	)
+
+	buf, er := json.Marshal(e)
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	var rs Error
+	if er := json.Unmarshal(buf, &rs); er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+
+	attrs := rs.Attrs()
+	if len(attrs) != 7 {
+		fmt.Println(attrs)
+		t.Fail()
+		return
+	}
+	if attrs[0].Value != "ft" || attrs[1].Value != int64(1<<60) || attrs[2].Value != 1.5 || attrs[3].Value != true ||
+		attrs[4].Value != 1500*time.Millisecond || !attrs[5].Value.(time.Time).Equal(now) ||
+		attrs[6].Value.(map[string]interface{})["x"] != float64(1) {
+		fmt.Println(attrs)
+		t.Fail()
+		return
+	}
+}
+
+func TestReporterAttrs(t *testing.T) {
+	_, buf, er := JSON(WrapAttrs(NewFromString("nil return"), Int("user_id", 1)), nil)
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	var tmp struct {
+		Attrs []Attr `json:"attrs"`
+	}
+	if er := json.Unmarshal(buf, &tmp); er != nil || len(tmp.Attrs) != 1 || tmp.Attrs[0].Value != int64(1) {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+}
+
+func TestToString(t *testing.T) {
+	var p *int
+	if ToString(true) != "true" || ToString(uint(1)) != "1" || ToString([]int{1}) != "" || ToString(p) != "" || ToString(nil) != "" {
+		t.Fail()
+		return
+	}
+}
+
+func TestWrapContextValuesOnce(t *testing.T) {
+	e := WrapAttrs(WrapContext(fmt.Errorf("nil return"), map[string]interface{}{
+		"redis-url": "localhost:1111",
+	}), String("order_id", "o-2019"))
+
+	s := e.Error()
+	if strings.Count(s, "localhost:1111") != 1 || strings.Count(s, "o-2019") != 1 {
+		fmt.Println(s)
+		t.Fail()
+		return
+	}
+	if v, ok := e.(Error).Attr("redis-url"); !ok || v.Value != "localhost:1111" {
+		fmt.Println(Attrs(e))
+		t.Fail()
+		return
+	}
+
+	// still once after a json round-trip
+	buf, _ := json.Marshal(e)
+	var re Error
+	if er := json.Unmarshal(buf, &re); er != nil || strings.Count(re.Error(), "localhost:1111") != 1 {
+		fmt.Println(re.Error())
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,624 @@
+package errorx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes a Reporter, it can be loaded from a file by LoadConfig, or from environment variables by ConfigFromEnv.
+//
+//	{
+//	  "mode": "pro",
+//	  "urls": {"pro": "http://localhost:9191", "dev": "http://localhost:9192"},
+//	  "timeout": "15s",
+//	  "context_name": "ctx",
+//	  "redact": [{"keys": ["password", "token"]}, {"value_pattern": "1[3-9]\\d{9}", "hash": true}],
+//	  "sample": {"pro": {"first_n": 10, "period": "1h", "rate": 0.01, "codes": {"10001": 0.1}}},
+//	  "sinks": {"pro": [{"type": "file", "path": "/var/log/errorx/errors.jsonl"}, {"type": "stdout"}]}
+//	}
+//
+// Modes with an url report errors to it, unless handlers are added by AddModeHandler, or sinks are configured.
+type Config struct {
+	Mode        string                  `json:"mode" yaml:"mode"`
+	URLs        map[string]string       `json:"urls,omitempty" yaml:"urls"`
+	Timeout     ConfigDuration          `json:"timeout,omitempty" yaml:"timeout"`
+	ContextName string                  `json:"context_name,omitempty" yaml:"context_name"`
+	Redact      []RedactConfig          `json:"redact,omitempty" yaml:"redact"`
+	Sample      map[string]SampleConfig `json:"sample,omitempty" yaml:"sample"`
+	Sinks       map[string][]SinkConfig `json:"sinks,omitempty" yaml:"sinks"`
+}
+
+// RedactConfig describes a RedactRule.
+type RedactConfig struct {
+	Keys         []string `json:"keys,omitempty" yaml:"keys"`
+	KeyPattern   string   `json:"key_pattern,omitempty" yaml:"key_pattern"`
+	ValuePattern string   `json:"value_pattern,omitempty" yaml:"value_pattern"`
+	Hash         bool     `json:"hash,omitempty" yaml:"hash"`
+}
+
+// SampleConfig describes the Sampler of a mode, mode "" is for modes without their own.
+// Errors are kept with Rate, or the first FirstN of each error in Period are kept and the rest with Rate.
+// Service errors with errcode in Codes are kept with their rates.
+type SampleConfig struct {
+	// nil means 1
+	Rate   *float64 `json:"rate,omitempty" yaml:"rate"`
+	FirstN int      `json:"first_n,omitempty" yaml:"first_n"`
+	// default 1h
+	Period ConfigDuration  `json:"period,omitempty" yaml:"period"`
+	Codes  map[int]float64 `json:"codes,omitempty" yaml:"codes"`
+}
+
+// SinkConfig describes a sink of a mode, Type is one of:
+//
+//	file     FileSink, with path, max_size, max_backups and flush_interval
+//	stdout   stdout, with pretty
+//	webhook  WebhookSink, with url, method, headers, template and timeout
+type SinkConfig struct {
+	Type       string `json:"type" yaml:"type"`
+	Path       string `json:"path,omitempty" yaml:"path"`
+	MaxSize    int64  `json:"max_size,omitempty" yaml:"max_size"`
+	MaxBackups int    `json:"max_backups,omitempty" yaml:"max_backups"`
+	// negative writes each report out at once
+	FlushInterval ConfigDuration    `json:"flush_interval,omitempty" yaml:"flush_interval"`
+	Pretty        bool              `json:"pretty,omitempty" yaml:"pretty"`
+	URL           string            `json:"url,omitempty" yaml:"url"`
+	Method        string            `json:"method,omitempty" yaml:"method"`
+	Headers       map[string]string `json:"headers,omitempty" yaml:"headers"`
+	Template      string            `json:"template,omitempty" yaml:"template"`
+	Timeout       ConfigDuration    `json:"timeout,omitempty" yaml:"timeout"`
+}
+
+// Sink builds the sink described by sc, a file sink opens its file.
+func (sc SinkConfig) Sink() (Sink, error) {
+	switch sc.Type {
+	case "file":
+		return NewFileSink(FileSinkOption{
+			Path:          sc.Path,
+			MaxSize:       sc.MaxSize,
+			MaxBackups:    sc.MaxBackups,
+			FlushInterval: time.Duration(sc.FlushInterval),
+		})
+	case "stdout":
+		return NewStdoutSink(sc.Pretty), nil
+	case "webhook":
+		return NewWebhookSink(WebhookSinkOption{
+			URL:      sc.URL,
+			Method:   sc.Method,
+			Headers:  sc.Headers,
+			Template: sc.Template,
+			Timeout:  time.Duration(sc.Timeout),
+		})
+	}
+	return nil, fmt.Errorf("errorx: unknown sink type '%s'", sc.Type)
+}
+
+// ConfigDuration is a time.Duration written as a string like "1.5s" in config.
+type ConfigDuration time.Duration
+
+func (d ConfigDuration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *ConfigDuration) UnmarshalText(buf []byte) error {
+	v, er := time.ParseDuration(string(buf))
+	if er != nil {
+		return er
+	}
+	*d = ConfigDuration(v)
+	return nil
+}
+
+var (
+	configDecodersL sync.RWMutex
+	configDecoders  = map[string]func(buf []byte, v interface{}) error{
+		".json": decodeJSONConfig,
+		".yaml": decodeYAMLConfig,
+		".yml":  decodeYAMLConfig,
+	}
+)
+
+// RegisterConfigDecoder makes LoadConfig decode files with extension ext by decode.
+// JSON and YAML are supported by default, other formats like toml can be registered:
+//
+//	errorx.RegisterConfigDecoder(".toml", toml.Unmarshal)
+func RegisterConfigDecoder(ext string, decode func(buf []byte, v interface{}) error) {
+	configDecodersL.Lock()
+	defer configDecodersL.Unlock()
+	configDecoders[strings.ToLower(ext)] = decode
+}
+
+func decodeJSONConfig(buf []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+func decodeYAMLConfig(buf []byte, v interface{}) error {
+	d := yaml.NewDecoder(bytes.NewReader(buf))
+	d.KnownFields(true)
+	return d.Decode(v)
+}
+
+// LoadConfig loads config from a file, decoded by the decoder of its extension, see RegisterConfigDecoder.
+func LoadConfig(path string) (Config, error) {
+	var c Config
+
+	ext := strings.ToLower(filepath.Ext(path))
+	configDecodersL.RLock()
+	decode, ok := configDecoders[ext]
+	configDecodersL.RUnlock()
+	if !ok {
+		return c, fmt.Errorf("errorx: config '%s': no decoder for extension '%s', see RegisterConfigDecoder", path, ext)
+	}
+
+	buf, er := ioutil.ReadFile(path)
+	if er != nil {
+		return c, fmt.Errorf("errorx: config '%s': %s", path, er.Error())
+	}
+	if er := decode(buf, &c); er != nil {
+		return c, fmt.Errorf("errorx: config '%s': %s", path, er.Error())
+	}
+	return c, nil
+}
+
+// Environment variables read by ConfigFromEnv.
+//
+//	ERRORX_CONFIG            path of a config file loaded first, the rest override it
+//	ERRORX_MODE              mode
+//	ERRORX_URL_<MODE>        url of mode, like ERRORX_URL_PRO, mode is lower-cased
+//	ERRORX_TIMEOUT           timeout like 15s
+//	ERRORX_CONTEXT_NAME      context name
+//	ERRORX_REDACT_KEYS       keys redacted, separated by ','
+//	ERRORX_REDACT_HASH       true to redact these keys into hashes
+//	ERRORX_REDACT            json of 'redact' in Config, the rule of ERRORX_REDACT_KEYS is added after it
+//	ERRORX_SAMPLE            json of 'sample' in Config
+//	ERRORX_SAMPLE_RATE       sample rate of all modes
+//	ERRORX_SAMPLE_RATE_<MODE> sample rate of mode
+//	ERRORX_SINKS             json of 'sinks' in Config
+//	ERRORX_SINKS_<MODE>      json of sinks of mode, like [{"type": "stdout"}]
+//
+// Other variables with the prefix are ignored, they may belong to something else.
+const EnvPrefix = "ERRORX_"
+
+// ConfigFromEnv loads config from environment variables, see EnvPrefix.
+func ConfigFromEnv() (Config, error) {
+	return configFromEnv(os.Environ())
+}
+
+func configFromEnv(environ []string) (Config, error) {
+	var (
+		c   Config
+		env = make(map[string]string, 0)
+	)
+	for _, v := range environ {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) == 2 && strings.HasPrefix(kv[0], EnvPrefix) {
+			env[kv[0]] = kv[1]
+		}
+	}
+
+	if path := env[EnvPrefix+"CONFIG"]; path != "" {
+		var er error
+		if c, er = LoadConfig(path); er != nil {
+			return c, er
+		}
+	}
+
+	envError := func(key string, er error) error {
+		return fmt.Errorf("errorx: env %s: %s", key, er.Error())
+	}
+
+	var keys = make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var redact RedactConfig
+	for _, k := range keys {
+		v := env[k]
+		name := strings.TrimPrefix(k, EnvPrefix)
+		switch {
+		case name == "CONFIG":
+		case name == "MODE":
+			c.Mode = v
+		case name == "TIMEOUT":
+			if er := c.Timeout.UnmarshalText([]byte(v)); er != nil {
+				return c, envError(k, er)
+			}
+		case name == "CONTEXT_NAME":
+			c.ContextName = v
+		case name == "REDACT_KEYS":
+			for _, key := range strings.Split(v, ",") {
+				if key = strings.TrimSpace(key); key != "" {
+					redact.Keys = append(redact.Keys, key)
+				}
+			}
+		case name == "REDACT_HASH":
+			hash, er := strconv.ParseBool(v)
+			if er != nil {
+				return c, envError(k, er)
+			}
+			redact.Hash = hash
+		case name == "REDACT":
+			c.Redact = nil
+			if er := json.Unmarshal([]byte(v), &c.Redact); er != nil {
+				return c, envError(k, er)
+			}
+		case name == "SAMPLE":
+			c.Sample = nil
+			if er := json.Unmarshal([]byte(v), &c.Sample); er != nil {
+				return c, envError(k, er)
+			}
+		case name == "SINKS":
+			c.Sinks = nil
+			if er := json.Unmarshal([]byte(v), &c.Sinks); er != nil {
+				return c, envError(k, er)
+			}
+		case strings.HasPrefix(name, "SINKS_"):
+			var sinks []SinkConfig
+			if er := json.Unmarshal([]byte(v), &sinks); er != nil {
+				return c, envError(k, er)
+			}
+			if c.Sinks == nil {
+				c.Sinks = make(map[string][]SinkConfig, 0)
+			}
+			c.Sinks[strings.ToLower(strings.TrimPrefix(name, "SINKS_"))] = sinks
+		case strings.HasPrefix(name, "URL_"):
+			if c.URLs == nil {
+				c.URLs = make(map[string]string, 0)
+			}
+			c.URLs[strings.ToLower(strings.TrimPrefix(name, "URL_"))] = v
+		case name == "SAMPLE_RATE" || strings.HasPrefix(name, "SAMPLE_RATE_"):
+			rate, er := strconv.ParseFloat(v, 64)
+			if er != nil {
+				return c, envError(k, er)
+			}
+			mode := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(name, "SAMPLE_RATE"), "_"))
+			if c.Sample == nil {
+				c.Sample = make(map[string]SampleConfig, 0)
+			}
+			sc := c.Sample[mode]
+			sc.Rate = &rate
+			c.Sample[mode] = sc
+		}
+	}
+	if len(redact.Keys) != 0 {
+		c.Redact = append(c.Redact, redact)
+	}
+	return c, nil
+}
+
+// Validate checks c, the error returned lists every problem with its path in config.
+func (c Config) Validate() error {
+	var me MultiError
+	invalid := func(path string, format string, args ...interface{}) {
+		me.Append(fmt.Errorf("errorx: config %s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Mode == "" {
+		invalid("mode", "required")
+	}
+	for _, mode := range sortedModes(c.URLs) {
+		v := c.URLs[mode]
+		if mode == "" {
+			invalid("urls", "empty mode")
+		}
+		u, er := url.Parse(v)
+		switch {
+		case er != nil:
+			invalid("urls."+mode, "%s", er.Error())
+		case u.Scheme != "http" && u.Scheme != "https":
+			invalid("urls."+mode, "scheme of '%s' should be http or https", v)
+		case u.Host == "":
+			invalid("urls."+mode, "host of '%s' is empty", v)
+		}
+	}
+	if c.Timeout < 0 {
+		invalid("timeout", "negative %s", time.Duration(c.Timeout))
+	}
+
+	for i, v := range c.Redact {
+		path := fmt.Sprintf("redact[%d]", i)
+		if len(v.Keys) == 0 && v.KeyPattern == "" && v.ValuePattern == "" {
+			invalid(path, "one of keys, key_pattern and value_pattern is required")
+		}
+		if _, er := regexp.Compile(v.KeyPattern); er != nil {
+			invalid(path+".key_pattern", "%s", er.Error())
+		}
+		if _, er := regexp.Compile(v.ValuePattern); er != nil {
+			invalid(path+".value_pattern", "%s", er.Error())
+		}
+	}
+
+	for _, mode := range sortedSampleModes(c.Sample) {
+		v := c.Sample[mode]
+		path := "sample." + mode
+		if v.Rate != nil && (*v.Rate < 0 || *v.Rate > 1) {
+			invalid(path+".rate", "%v out of [0, 1]", *v.Rate)
+		}
+		if v.FirstN < 0 {
+			invalid(path+".first_n", "negative %d", v.FirstN)
+		}
+		if v.Period < 0 {
+			invalid(path+".period", "negative %s", time.Duration(v.Period))
+		}
+		var codes = make([]int, 0, len(v.Codes))
+		for code := range v.Codes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			if rate := v.Codes[code]; rate < 0 || rate > 1 {
+				invalid(fmt.Sprintf("%s.codes.%d", path, code), "%v out of [0, 1]", rate)
+			}
+		}
+	}
+
+	var sinkModes = make([]string, 0, len(c.Sinks))
+	for mode := range c.Sinks {
+		sinkModes = append(sinkModes, mode)
+	}
+	sort.Strings(sinkModes)
+	for _, mode := range sinkModes {
+		for i, v := range c.Sinks[mode] {
+			path := fmt.Sprintf("sinks.%s[%d]", mode, i)
+			switch v.Type {
+			case "file":
+				if v.Path == "" {
+					invalid(path+".path", "required")
+				}
+				if v.MaxBackups < 0 {
+					invalid(path+".max_backups", "negative %d", v.MaxBackups)
+				}
+			case "stdout":
+			case "webhook":
+				u, er := url.Parse(v.URL)
+				switch {
+				case er != nil:
+					invalid(path+".url", "%s", er.Error())
+				case u.Scheme != "http" && u.Scheme != "https":
+					invalid(path+".url", "scheme of '%s' should be http or https", v.URL)
+				case u.Host == "":
+					invalid(path+".url", "host of '%s' is empty", v.URL)
+				}
+				if _, er := template.New("webhook").Funcs(template.FuncMap{"json": webhookJSON}).Parse(v.Template); er != nil {
+					invalid(path+".template", "%s", er.Error())
+				}
+				if v.Timeout < 0 {
+					invalid(path+".timeout", "negative %s", time.Duration(v.Timeout))
+				}
+			default:
+				invalid(path+".type", "unknown type '%s', should be file, stdout or webhook", v.Type)
+			}
+		}
+	}
+
+	return me.ErrorOrNil()
+}
+
+func sortedModes(m map[string]string) []string {
+	var rs = make([]string, 0, len(m))
+	for k := range m {
+		rs = append(rs, k)
+	}
+	sort.Strings(rs)
+	return rs
+}
+
+func sortedSampleModes(m map[string]SampleConfig) []string {
+	var rs = make([]string, 0, len(m))
+	for k := range m {
+		rs = append(rs, k)
+	}
+	sort.Strings(rs)
+	return rs
+}
+
+// Redactor builds the redactor of c, nil if c has no redact rule.
+func (c Config) Redactor() (*Redactor, error) {
+	if len(c.Redact) == 0 {
+		return nil, nil
+	}
+	var rules = make([]RedactRule, 0, len(c.Redact))
+	for i, v := range c.Redact {
+		rule := RedactRule{Keys: v.Keys, Hash: v.Hash}
+		var er error
+		if v.KeyPattern != "" {
+			if rule.KeyPattern, er = regexp.Compile(v.KeyPattern); er != nil {
+				return nil, fmt.Errorf("errorx: config redact[%d].key_pattern: %s", i, er.Error())
+			}
+		}
+		if v.ValuePattern != "" {
+			if rule.ValuePattern, er = regexp.Compile(v.ValuePattern); er != nil {
+				return nil, fmt.Errorf("errorx: config redact[%d].value_pattern: %s", i, er.Error())
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return NewRedactor(rules...), nil
+}
+
+// Sampler builds the sampler described by sc.
+func (sc SampleConfig) Sampler() Sampler {
+	var rate float64 = 1
+	if sc.Rate != nil {
+		rate = *sc.Rate
+	}
+
+	var s Sampler
+	if sc.FirstN > 0 {
+		period := time.Duration(sc.Period)
+		if period <= 0 {
+			period = time.Hour
+		}
+		s = FirstNSampler(sc.FirstN, period, rate)
+	} else {
+		s = RateSampler(rate)
+	}
+	if len(sc.Codes) != 0 {
+		s = CodeSampler(sc.Codes, s)
+	}
+	return s
+}
+
+// NewReporterFromConfig validates c and builds a Reporter from it.
+func NewReporterFromConfig(c Config) (*Reporter, error) {
+	if er := c.Validate(); er != nil {
+		return nil, er
+	}
+	r := NewReporter(c.Mode)
+	if er := r.ApplyConfig(c); er != nil {
+		return nil, er
+	}
+	return r, nil
+}
+
+// reporterConfig is the state of a Config applied, it's never modified after being applied, except being closed.
+type reporterConfig struct {
+	c     *http.Client
+	urls  map[string]string
+	sinks map[string][]Sink
+
+	// reports being written to sinks, sinks are closed after them when the config is replaced
+	l        sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+}
+
+// acquire keeps sinks of rc open until release, it returns false when rc is closed.
+func (rc *reporterConfig) acquire() bool {
+	rc.l.Lock()
+	defer rc.l.Unlock()
+	if rc.closed {
+		return false
+	}
+	rc.inflight.Add(1)
+	return true
+}
+
+func (rc *reporterConfig) release() {
+	rc.inflight.Done()
+}
+
+// close waits for reports being written to sinks, then closes them.
+func (rc *reporterConfig) close() {
+	rc.l.Lock()
+	rc.closed = true
+	rc.l.Unlock()
+	rc.inflight.Wait()
+	closeSinks(rc.sinks)
+}
+
+// ApplyConfig validates c and applies it to r, it's safe to call while errors are being reported, to reload config.
+// Urls, timeout, context name, redaction, samplers and sinks of c replace those applied before, and samplers set by SetSampler.
+// Sinks of the config applied before are closed once reports being written to them finish, sinks added by AddSink are kept.
+// Handlers added by AddModeHandler are kept, and win over c.
+// The mode of r is not changed, since errors being reported read it, the mode of c is used by NewReporterFromConfig,
+// call Mode(c.Mode) for a reporter of another mode.
+func (r *Reporter) ApplyConfig(c Config) error {
+	if er := c.Validate(); er != nil {
+		return er
+	}
+	rd, er := c.Redactor()
+	if er != nil {
+		return er
+	}
+
+	var samplers = make(map[string]Sampler, len(c.Sample))
+	for mode, v := range c.Sample {
+		samplers[mode] = v.Sampler()
+	}
+
+	timeout := time.Duration(c.Timeout)
+	if timeout == 0 {
+		timeout = 15 * time.Second
+	}
+	rc := &reporterConfig{
+		c:    &http.Client{Timeout: timeout},
+		urls: make(map[string]string, len(c.URLs)),
+	}
+	for k, v := range c.URLs {
+		rc.urls[k] = v
+	}
+	if rc.sinks, er = c.buildSinks(); er != nil {
+		return er
+	}
+
+	if r.shared == nil {
+		r.shared = &reporterShared{}
+	}
+	r.shared.l.Lock()
+	old := r.shared.config
+	r.shared.config = rc
+	r.shared.contextName = c.ContextName
+	r.shared.redactor = rd
+	r.shared.samplers = samplers
+	r.shared.l.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// configHandler returns the handler of mode by the config applied, nil if the mode has no url in config.
+func (r *Reporter) configHandler(mode string) func(e error, context map[string]interface{}) {
+	if r.shared == nil {
+		return nil
+	}
+	r.shared.l.RLock()
+	rc := r.shared.config
+	r.shared.l.RUnlock()
+	if rc == nil {
+		return nil
+	}
+	u, ok := rc.urls[mode]
+	if !ok {
+		return nil
+	}
+	return func(e error, context map[string]interface{}) {
+		r.reportURL(rc.c, u, e, context)
+	}
+}
+
+func (c Config) buildSinks() (map[string][]Sink, error) {
+	var rs = make(map[string][]Sink, len(c.Sinks))
+	for mode, v := range c.Sinks {
+		for i, sc := range v {
+			s, er := sc.Sink()
+			if er != nil {
+				closeSinks(rs)
+				return nil, fmt.Errorf("errorx: config sinks.%s[%d]: %s", mode, i, er.Error())
+			}
+			rs[mode] = append(rs[mode], s)
+		}
+	}
+	return rs, nil
+}
+
+func closeSinks(sinks map[string][]Sink) {
+	for _, v := range sinks {
+		for _, s := range v {
+			if er := s.Close(context.Background()); er != nil {
+				fmt.Printf("errorx: close sink %T fail, err=%s\n", s, er.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package errorx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "errorx.json")
+	ioutil.WriteFile(path, []byte(`{
+  "mode": "pro",
+  "urls": {"pro": "http://localhost:9191"},
+  "timeout": "3s",
+  "redact": [{"keys": ["password"]}],
+  "sample": {"pro": {"first_n": 10, "period": "1h", "rate": 0.01, "codes": {"10001": 0.1}}}
+}`), 0644)
+
+	c, er := LoadConfig(path)
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	if c.Mode != "pro" || time.Duration(c.Timeout) != 3*time.Second || c.Sample["pro"].Codes[10001] != 0.1 || *c.Sample["pro"].Rate != 0.01 {
+		fmt.Println(c)
+		t.Fail()
+		return
+	}
+	if er := c.Validate(); er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+
+	ioutil.WriteFile(path, []byte(`{"mode": "pro", "url": {}}`), 0644)
+	if _, er := LoadConfig(path); er == nil || !strings.Contains(er.Error(), `unknown field "url"`) {
+		fmt.Println(er)
+		t.Fail()
+		return
+	}
+	if _, er := LoadConfig(filepath.Join(dir, "errorx.toml")); er == nil || !strings.Contains(er.Error(), "no decoder") {
+		fmt.Println(er)
+		t.Fail()
+		return
+	}
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "errorx.yaml")
+	ioutil.WriteFile(path, []byte(`
+mode: pro
+urls:
+  pro: http://localhost:9191
+timeout: 3s
+context_name: ctx
+redact:
+  - keys: [password]
+sample:
+  pro:
+    first_n: 10
+    period: 1h
+    rate: 0.01
+    codes:
+      10001: 0.1
+sinks:
+  pro:
+    - type: stdout
+      pretty: true
+`), 0644)
+
+	c, er := LoadConfig(path)
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	if c.Mode != "pro" || c.URLs["pro"] != "http://localhost:9191" || time.Duration(c.Timeout) != 3*time.Second ||
+		time.Duration(c.Sample["pro"].Period) != time.Hour || c.Sample["pro"].Codes[10001] != 0.1 || !c.Sinks["pro"][0].Pretty {
+		fmt.Println(c)
+		t.Fail()
+		return
+	}
+	if er := c.Validate(); er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+
+	ioutil.WriteFile(path, []byte("mode: pro\nurl: {}\n"), 0644)
+	if _, er := LoadConfig(path); er == nil || !strings.Contains(er.Error(), "field url not found") {
+		fmt.Println(er)
+		t.Fail()
+		return
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	rate := 1.5
+	c := Config{
+		URLs:   map[string]string{"pro": "localhost:9191"},
+		Redact: []RedactConfig{{}, {ValuePattern: "("}},
+		Sample: map[string]SampleConfig{"pro": {Rate: &rate, Codes: map[int]float64{10001: -1}}},
+	}
+	er := c.Validate()
+	if er == nil {
+		t.Fail()
+		return
+	}
+	for _, v := range []string{
+		"errorx: config mode: required",
+		"errorx: config urls.pro: scheme of 'localhost:9191' should be http or https",
+		"errorx: config redact[0]: one of keys, key_pattern and value_pattern is required",
+		"errorx: config redact[1].value_pattern: error parsing regexp",
+		"errorx: config sample.pro.rate: 1.5 out of [0, 1]",
+		"errorx: config sample.pro.codes.10001: -1 out of [0, 1]",
+	} {
+		if !strings.Contains(er.Error(), v) {
+			fmt.Println(er.Error())
+			t.Fail()
+			return
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	c, er := configFromEnv([]string{
+		"HOME=/root",
+		"ERRORX_MODE=pro",
+		"ERRORX_URL_PRO=http://localhost:9191",
+		"ERRORX_TIMEOUT=5s",
+		"ERRORX_REDACT_KEYS=password, token",
+		"ERRORX_SAMPLE_RATE=0.5",
+		"ERRORX_SAMPLE_RATE_PRO=0.1",
+	})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	if c.Mode != "pro" || c.URLs["pro"] != "http://localhost:9191" || time.Duration(c.Timeout) != 5*time.Second ||
+		len(c.Redact) != 1 || len(c.Redact[0].Keys) != 2 || *c.Sample[""].Rate != 0.5 || *c.Sample["pro"].Rate != 0.1 {
+		fmt.Println(c)
+		t.Fail()
+		return
+	}
+
+	if _, er := configFromEnv([]string{"ERRORX_TIMEOUT=5"}); er == nil || !strings.Contains(er.Error(), "errorx: env ERRORX_TIMEOUT") {
+		fmt.Println(er)
+		t.Fail()
+		return
+	}
+
+	// sinks, and sections in json, other variables are ignored
+	c, er = configFromEnv([]string{
+		"ERRORX_MODE=pro",
+		`ERRORX_SINKS={"dev": [{"type": "stdout"}]}`,
+		`ERRORX_SINKS_PRO=[{"type": "file", "path": "/var/log/errorx/errors.jsonl", "flush_interval": "2s"}]`,
+		`ERRORX_SAMPLE={"pro": {"first_n": 10, "period": "1h", "codes": {"10001": 0.1}}}`,
+		"ERRORX_SAMPLE_RATE_PRO=0.01",
+		`ERRORX_REDACT=[{"value_pattern": "1[3-9]\\d{9}", "hash": true}]`,
+		"ERRORX_REDACT_KEYS=password",
+		"ERRORX_AGENT_TOKEN=xxx",
+	})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	if len(c.Sinks["dev"]) != 1 || c.Sinks["pro"][0].Path != "/var/log/errorx/errors.jsonl" ||
+		time.Duration(c.Sinks["pro"][0].FlushInterval) != 2*time.Second ||
+		c.Sample["pro"].FirstN != 10 || c.Sample["pro"].Codes[10001] != 0.1 || *c.Sample["pro"].Rate != 0.01 ||
+		len(c.Redact) != 2 || !c.Redact[0].Hash || c.Redact[1].Keys[0] != "password" {
+		fmt.Println(c)
+		t.Fail()
+		return
+	}
+	if er := c.Validate(); er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+
+	if _, er := configFromEnv([]string{"ERRORX_SINKS_PRO={"}); er == nil || !strings.Contains(er.Error(), "errorx: env ERRORX_SINKS_PRO") {
+		fmt.Println(er)
+		t.Fail()
+		return
+	}
+}
+
+func TestReporterConfigReload(t *testing.T) {
+	var (
+		l      sync.Mutex
+		hits   = make(map[string]int, 0)
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		l.Lock()
+		defer l.Unlock()
+		hits[r.URL.Path]++
+		bodies = append(bodies, string(buf))
+	}))
+	defer srv.Close()
+
+	rp, er := NewReporterFromConfig(Config{
+		Mode:        "pro",
+		URLs:        map[string]string{"pro": srv.URL + "/v1"},
+		ContextName: "ctx",
+		Redact:      []RedactConfig{{Keys: []string{"password"}}},
+	})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	rp.SaveError(NewFromString("nil return"), map[string]interface{}{"password": "123456"})
+
+	if er := rp.ApplyConfig(Config{Mode: "pro", URLs: map[string]string{"pro": srv.URL + "/v2"}}); er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	rp.SaveError(NewFromString("nil return"), map[string]interface{}{"password": "123456"})
+
+	if er := rp.ApplyConfig(Config{}); er == nil {
+		t.Fail()
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if hits["/v1"] != 1 || hits["/v2"] != 1 || !strings.Contains(bodies[0], `"ctx"`) || strings.Contains(bodies[0], "123456") ||
+		!strings.Contains(bodies[1], "123456") {
+		fmt.Println(hits, bodies)
+		t.Fail()
+		return
+	}
+}
+
+func TestReporterConfigReloadConcurrently(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx")
+	defer os.RemoveAll(dir)
+
+	config := func(i int) Config {
+		return Config{
+			Mode:  "pro",
+			Sinks: map[string][]SinkConfig{"pro": {{Type: "file", Path: filepath.Join(dir, fmt.Sprintf("errors-%d.jsonl", i))}}},
+		}
+	}
+	rp, er := NewReporterFromConfig(config(0))
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	m := NewMetrics()
+	rp.SetMetrics(m)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				rp.SaveError(NewFromString("nil return"), nil)
+			}
+		}()
+	}
+	// sinks replaced are closed after reports being written to them, and the mode of config doesn't race with them
+	for i := 1; i <= 20; i++ {
+		c := config(i)
+		c.Mode = fmt.Sprintf("mode-%d", i)
+		if er := rp.ApplyConfig(c); er != nil {
+			fmt.Println(er.Error())
+			t.Fail()
+			return
+		}
+	}
+	wg.Wait()
+	rp.Close(context.Background())
+
+	if n := m.Counter("reporter_sink_failed", MetricLabels{Mode: "pro", Handler: "*errorx.FileSink"}); n != 0 {
+		fmt.Println(n)
+		t.Fail()
+		return
+	}
+	if n := m.Counter("reporter_saved", MetricLabels{Mode: "pro"}); n != 400 {
+		fmt.Println(n)
+		t.Fail()
+		return
+	}
+}
+
+func TestReporterConfigContextName(t *testing.T) {
+	var (
+		l    sync.Mutex
+		body string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		l.Lock()
+		defer l.Unlock()
+		body = string(buf)
+	}))
+	defer srv.Close()
+
+	rp, er := NewReporterFromConfig(Config{Mode: "dev", ContextName: "ctx"})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	// context name of config applies to ReportURLHandler as well as urls of config
+	rp.AddURL("dev", srv.URL)
+	rp.AddModeHandler("dev", rp.ReportURLHandler)
+	rp.SaveError(NewFromString("nil return"), map[string]interface{}{"user_id": 1})
+
+	l.Lock()
+	defer l.Unlock()
+	if !strings.Contains(body, `"ctx"`) || strings.Contains(body, `"context"`) {
+		fmt.Println(body)
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,129 @@
+package errorx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// FieldRequestID is the field key of WithRequestID.
+const FieldRequestID = "request_id"
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx carrying fields, merged with fields already in ctx.
+// Errors made by WrapCtx and NewCtx, and reports saved by SaveErrorCtx pick them up.
+//
+//	ctx = errorx.WithFields(ctx, map[string]interface{}{"user_id": uid, "tenant": tenant})
+//	...
+//	return errorx.WrapCtx(ctx, e)
+func WithFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	old, _ := ctx.Value(fieldsKey{}).(map[string]interface{})
+
+	var rs = make(map[string]interface{}, len(old)+len(fields))
+	for k, v := range old {
+		rs[k] = v
+	}
+	for k, v := range fields {
+		rs[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, rs)
+}
+
+// WithField returns a copy of ctx carrying key=value, see WithFields.
+func WithField(ctx context.Context, key string, value interface{}) context.Context {
+	return WithFields(ctx, map[string]interface{}{key: value})
+}
+
+// WithRequestID returns a copy of ctx carrying the request id as field 'request_id'.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return WithField(ctx, FieldRequestID, requestID)
+}
+
+// RequestIDFromContext returns the request id set by WithRequestID.
+func RequestIDFromContext(ctx context.Context) string {
+	v, _ := FieldsFromContext(ctx)[FieldRequestID].(string)
+	return v
+}
+
+// FieldsFromContext returns a copy of fields carried by ctx, nil if none.
+func FieldsFromContext(ctx context.Context) map[string]interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).(map[string]interface{})
+	if len(fields) == 0 {
+		return nil
+	}
+	var rs = make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		rs[k] = v
+	}
+	return rs
+}
+
+// WrapCtx wraps e like Wrap, and adds fields of ctx to its header, and to attrs of the new layer.
+func WrapCtx(ctx context.Context, e error) error {
+	if e == nil {
+		return nil
+	}
+
+	errorX, desc := wrapped(e)
+	errorX.wrapStackLine(desc)
+	errorX.setFields(FieldsFromContext(ctx))
+	return errorX
+}
+
+// NewCtx news an error from msg like NewFromString, and adds fields of ctx to its header and attrs.
+func NewCtx(ctx context.Context, msg string) error {
+	v := empty()
+	v.E = errors.New(msg)
+	v.wrapStackLine(msg)
+	v.setFields(FieldsFromContext(ctx))
+	return v
+}
+
+// NewCtxf news an error from a well format string like NewFromStringf, and adds fields of ctx to its header and attrs.
+func NewCtxf(ctx context.Context, format string, args ...interface{}) error {
+	v := findErr(args...)
+	v.wrapStackLine(fmt.Sprintf(format, args...))
+	v.setFields(FieldsFromContext(ctx))
+	return v
+}
+
+// setFields sets fields as header, and attrs of the latest layer.
+// Header is copied before set, because it's shared with the error wrapped.
+func (e *Error) setFields(fields map[string]interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+
+	var header = make(map[string][]string, len(e.Header)+len(fields))
+	for k, v := range e.Header {
+		header[k] = v
+	}
+	e.Header = header
+	for k, v := range fields {
+		e.Header[k] = []string{ToString(v)}
+	}
+
+	if len(e.stackTracesV2) != 0 {
+		e.stackTracesV2[0].attrs = append(e.stackTracesV2[0].attrs, sortedAttrs(fields)...)
+	}
+}
+
+// SaveErrorCtx saves e like SaveError, with fields of ctx added to context.
+// Values in context win over fields of ctx with the same key. ctx is passed to sinks, see AddSink.
+func (r *Reporter) SaveErrorCtx(ctx context.Context, e error, context map[string]interface{}) string {
+	fields := FieldsFromContext(ctx)
+	if fields == nil {
+		fields = make(map[string]interface{}, len(context))
+	}
+	for k, v := range context {
+		fields[k] = v
+	}
+	return r.saveError(ctx, e, fields)
+}
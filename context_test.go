@@ -0,0 +1,64 @@
+package errorx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWrapCtx(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "req-1")
+	ctx = WithFields(ctx, map[string]interface{}{"user_id": 1, "tenant": "a"})
+
+	if RequestIDFromContext(ctx) != "req-1" || len(FieldsFromContext(ctx)) != 3 || FieldsFromContext(context.Background()) != nil {
+		fmt.Println(FieldsFromContext(ctx))
+		t.Fail()
+		return
+	}
+
+	e := WrapCtx(ctx, errors.New("nil return")).(Error)
+	if e.GetHeader(FieldRequestID) != "req-1" || e.GetHeader("user_id") != "1" {
+		fmt.Println(e.Header)
+		t.Fail()
+		return
+	}
+	if a, ok := e.Attr("user_id"); !ok || a.Value != int64(1) {
+		fmt.Println(e.Attrs())
+		t.Fail()
+		return
+	}
+
+	e = NewCtx(WithField(ctx, "tenant", "b"), "nil return").(Error)
+	if e.GetHeader("tenant") != "b" || e.Message() != "nil return" {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+
+	// header of the wrapped error is not touched
+	inner := NewFromString("nil return").(Error)
+	inner.SetHeader("api", "/user/info")
+	outer := WrapCtx(ctx, inner).(Error)
+	if inner.GetHeader(FieldRequestID) != "" || outer.GetHeader("api") != "/user/info" {
+		fmt.Println(inner.Header, outer.Header)
+		t.Fail()
+		return
+	}
+}
+
+func TestSaveErrorCtx(t *testing.T) {
+	var saved map[string]interface{}
+	rp := NewReporter("test")
+	rp.AddModeHandler("test", func(e error, ctx map[string]interface{}) {
+		saved = ctx
+	})
+
+	ctx := WithFields(WithRequestID(context.Background(), "req-1"), map[string]interface{}{"user_id": 1})
+	rp.SaveErrorCtx(ctx, NewFromString("nil return"), map[string]interface{}{"user_id": 2})
+	if saved[FieldRequestID] != "req-1" || saved["user_id"] != 2 || saved["error_uuid"] == nil {
+		fmt.Println(saved)
+		t.Fail()
+		return
+	}
+}
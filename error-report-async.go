@@ -0,0 +1,333 @@
+package errorx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AsyncOption configures asynchronous delivery of ReportURLHandler.
+// Zero fields use defaults.
+type AsyncOption struct {
+	// max reports buffered, the oldest report is dropped when the buffer is full. default 1000
+	QueueSize int
+	// max reports sent in a request, as a json array. default 50
+	BatchSize int
+	// a batch is sent when it's full or FlushInterval passes. default 1s
+	FlushInterval time.Duration
+	// retry times after the first try fails, negative means no retry. default 3
+	MaxRetry int
+	// backoff before the first retry, doubled for each retry with jitter, up to MaxBackoff. default 200ms, 10s
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (o AsyncOption) withDefault() AsyncOption {
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1000
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 50
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second
+	}
+	if o.MaxRetry == 0 {
+		o.MaxRetry = 3
+	} else if o.MaxRetry < 0 {
+		o.MaxRetry = 0
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = 200 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 10 * time.Second
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = o.MinBackoff
+	}
+	return o
+}
+
+// EnableAsync makes ReportURLHandler queue reports instead of posting them in the caller's goroutine.
+// Queued reports are posted to the mode's url in batches as json arrays, retried with exponential backoff and jitter.
+// Call Close to flush queued reports before exit.
+//
+//	rp := errorx.NewReporter("pro")
+//	rp.AddURL("pro", "http://localhost:9191")
+//	rp.AddModeHandler("pro", rp.ReportURLHandler)
+//	rp.EnableAsync(errorx.AsyncOption{})
+//	defer rp.Close(context.Background())
+func (r *Reporter) EnableAsync(opt AsyncOption) *Reporter {
+	if r.shared == nil {
+		r.shared = &reporterShared{}
+	}
+	as := newAsyncSender(r.c, opt.withDefault())
+	as.shared = r.shared
+
+	r.shared.l.Lock()
+	old := r.shared.async
+	r.shared.async = as
+	r.shared.l.Unlock()
+
+	if old != nil {
+		go old.close(context.Background())
+	}
+	go as.run()
+	return r
+}
+
+// Close flushes reports queued by asynchronous delivery, and stops it.
+// When ctx is done before flushing finishes, reports left are dropped and ctx.Err() is returned.
+// Reports coming after Close are posted synchronously.
+// Sinks are flushed and closed as well, see AddSink, errors of more than one are returned as a *MultiError.
+func (r *Reporter) Close(ctx context.Context) error {
+	var me MultiError
+	if as := r.asyncSender(); as != nil {
+		me.Append(as.close(ctx))
+	}
+	for _, v := range r.allSinks() {
+		me.Append(v.Close(ctx))
+	}
+	if es := me.Errors(); len(es) == 1 {
+		return es[0]
+	}
+	return me.ErrorOrNil()
+}
+
+// Dropped returns the number of reports dropped by asynchronous delivery, because of a full buffer,
+// retries running out, or Close timing out.
+func (r *Reporter) Dropped() int64 {
+	as := r.asyncSender()
+	if as == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&as.dropped)
+}
+
+func (r *Reporter) asyncSender() *asyncSender {
+	if r.shared == nil {
+		return nil
+	}
+	r.shared.l.RLock()
+	defer r.shared.l.RUnlock()
+	return r.shared.async
+}
+
+type asyncReport struct {
+	url  string
+	body []byte
+}
+
+type asyncSender struct {
+	c   *http.Client
+	opt AsyncOption
+
+	l      sync.Mutex
+	queue  []asyncReport
+	closed bool
+
+	notify  chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+
+	// ctx aborts requests and backoff when Close times out
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	closeOnce sync.Once
+	dropped   int64
+
+	// for metrics of the reporter
+	shared *reporterShared
+}
+
+func newAsyncSender(c *http.Client, opt AsyncOption) *asyncSender {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &asyncSender{
+		c:       c,
+		opt:     opt,
+		queue:   make([]asyncReport, 0, opt.BatchSize),
+		notify:  make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// enqueue returns false when the sender has been closed.
+func (as *asyncSender) enqueue(url string, body []byte) bool {
+	as.l.Lock()
+	defer as.l.Unlock()
+	if as.closed {
+		return false
+	}
+
+	if len(as.queue) >= as.opt.QueueSize {
+		as.queue[0] = asyncReport{}
+		as.queue = as.queue[1:]
+		atomic.AddInt64(&as.dropped, 1)
+		as.shared.metricsOrDefault().Add("reporter_async_dropped", MetricLabels{}, 1)
+	}
+	as.queue = append(as.queue, asyncReport{url: url, body: body})
+
+	if len(as.queue) >= as.opt.BatchSize {
+		select {
+		case as.notify <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+func (as *asyncSender) run() {
+	defer close(as.done)
+
+	ticker := time.NewTicker(as.opt.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-as.notify:
+			as.flush()
+		case <-ticker.C:
+			as.flush()
+		case <-as.closing:
+			as.flush()
+			return
+		}
+	}
+}
+
+func (as *asyncSender) close(ctx context.Context) error {
+	as.closeOnce.Do(func() {
+		as.l.Lock()
+		as.closed = true
+		as.l.Unlock()
+		close(as.closing)
+	})
+
+	select {
+	case <-as.done:
+		return nil
+	case <-ctx.Done():
+		as.cancel()
+		<-as.done
+		return ctx.Err()
+	}
+}
+
+// flush sends all queued reports, grouped by url in batches.
+func (as *asyncSender) flush() {
+	as.l.Lock()
+	queue := as.queue
+	as.queue = make([]asyncReport, 0, as.opt.BatchSize)
+	as.l.Unlock()
+
+	var (
+		order   = make([]string, 0, 2)
+		batches = make(map[string][][]byte, 0)
+	)
+	for _, v := range queue {
+		if _, ok := batches[v.url]; !ok {
+			order = append(order, v.url)
+		}
+		batches[v.url] = append(batches[v.url], v.body)
+	}
+
+	for _, url := range order {
+		bodies := batches[url]
+		for len(bodies) > 0 {
+			n := as.opt.BatchSize
+			if n > len(bodies) {
+				n = len(bodies)
+			}
+			as.send(url, bodies[:n])
+			bodies = bodies[n:]
+		}
+	}
+}
+
+// send posts a batch, retrying until it succeeds, retries run out or the sender is aborted.
+func (as *asyncSender) send(url string, bodies [][]byte) {
+	buf := make([]byte, 0, 512*len(bodies))
+	buf = append(buf, '[')
+	buf = append(buf, bytes.Join(bodies, []byte(","))...)
+	buf = append(buf, ']')
+
+	var er error
+	for i := 0; i <= as.opt.MaxRetry; i++ {
+		if i > 0 {
+			if !as.sleep(as.backoff(i)) {
+				break
+			}
+			as.shared.metricsOrDefault().Add("reporter_async_retried", MetricLabels{}, 1)
+		}
+		var retry bool
+		if retry, er = as.post(url, buf); er == nil || !retry {
+			break
+		}
+	}
+	if er == nil {
+		return
+	}
+
+	atomic.AddInt64(&as.dropped, int64(len(bodies)))
+	as.shared.metricsOrDefault().Add("reporter_async_dropped", MetricLabels{}, int64(len(bodies)))
+	fmt.Printf("errorx: report %d errors to '%s' fail, err=%s\n", len(bodies), url, er.Error())
+}
+
+// post returns whether the failure is worth retrying.
+func (as *asyncSender) post(url string, buf []byte) (bool, error) {
+	req, er := http.NewRequest("POST", url, bytes.NewReader(buf))
+	if er != nil {
+		return false, er
+	}
+	req = req.WithContext(as.ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, er := as.c.Do(req)
+	if er != nil {
+		return as.ctx.Err() == nil, er
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return true, fmt.Errorf("response status %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 {
+		return false, fmt.Errorf("response status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// backoff of the i-th retry, in [d/2, d) where d = MinBackoff * 2^(i-1) capped by MaxBackoff
+func (as *asyncSender) backoff(i int) time.Duration {
+	d := as.opt.MinBackoff
+	for j := 1; j < i && d < as.opt.MaxBackoff; j++ {
+		d *= 2
+	}
+	if d > as.opt.MaxBackoff {
+		d = as.opt.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep returns false if the sender is aborted
+func (as *asyncSender) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-as.ctx.Done():
+		return false
+	}
+}
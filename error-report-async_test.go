@@ -0,0 +1,101 @@
+package errorx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReporterAsync(t *testing.T) {
+	var (
+		l        sync.Mutex
+		requests int
+		reports  int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Lock()
+		defer l.Unlock()
+		requests++
+		// the first request fails and should be retried
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		buf, _ := ioutil.ReadAll(r.Body)
+		var batch []map[string]interface{}
+		if e := json.Unmarshal(buf, &batch); e != nil {
+			fmt.Println(e.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reports += len(batch)
+	}))
+	defer server.Close()
+
+	rp := NewReporter("pro")
+	rp.AddURL("pro", server.URL)
+	rp.AddModeHandler("pro", rp.ReportURLHandler)
+	rp.EnableAsync(AsyncOption{
+		BatchSize:     4,
+		FlushInterval: time.Hour,
+		MinBackoff:    time.Millisecond,
+	})
+
+	for i := 0; i < 10; i++ {
+		rp.SaveError(errors.New("nil return"), map[string]interface{}{
+			"index": i,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if e := rp.Close(ctx); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if reports != 10 || rp.Dropped() != 0 {
+		fmt.Println(reports, requests, rp.Dropped())
+		t.Fail()
+		return
+	}
+}
+
+func TestReporterAsyncDropOldest(t *testing.T) {
+	rp := NewReporter("pro")
+	rp.AddURL("pro", "http://127.0.0.1:1")
+	rp.AddModeHandler("pro", rp.ReportURLHandler)
+	rp.EnableAsync(AsyncOption{
+		QueueSize:     3,
+		BatchSize:     100,
+		FlushInterval: time.Hour,
+		MaxRetry:      -1,
+	})
+
+	for i := 0; i < 5; i++ {
+		rp.SaveError(errors.New("nil return"), nil)
+	}
+	if rp.Dropped() != 2 {
+		fmt.Println(rp.Dropped())
+		t.Fail()
+		return
+	}
+
+	// the 3 reports left can't be delivered
+	rp.Close(context.Background())
+	if rp.Dropped() != 5 {
+		fmt.Println(rp.Dropped())
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,164 @@
+package errorx
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SetDedup folds repeats of the same error in mode together.
+// Within a window starting from an error's first occurrence, only the first 'limit' occurrences of its keyword are
+// reported, the rest are suppressed. When the window ends, if any occurrence has been suppressed, a summary report of
+// the last suppressed error is sent with context:
+//
+//	dedup_keyword  keyword of the error
+//	dedup_count    occurrences in the window, including reported ones
+//	dedup_first    time of the first occurrence
+//	dedup_last     time of the last occurrence
+//
+// Mode "" sets the rule for modes without their own. A window <= 0 removes the rule.
+// Errors are identified by Fingerprint, use SetKeywordFunc to change it.
+// SaveError still returns an error uuid for a suppressed error, but it's never reported.
+func (r *Reporter) SetDedup(mode string, window time.Duration, limit int) *Reporter {
+	d := r.mustDeduper()
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	if window <= 0 {
+		delete(d.rules, mode)
+		return r
+	}
+	if limit <= 0 {
+		limit = 1
+	}
+	d.rules[mode] = dedupRule{
+		window: window,
+		limit:  limit,
+	}
+	return r
+}
+
+// SetKeywordFunc sets how errors are identified in deduplication.
+func (r *Reporter) SetKeywordFunc(f func(e error) string) *Reporter {
+	d := r.mustDeduper()
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.keyword = f
+	return r
+}
+
+func (r *Reporter) deduper() *deduper {
+	if r.shared == nil {
+		return nil
+	}
+	r.shared.l.RLock()
+	defer r.shared.l.RUnlock()
+	return r.shared.dedup
+}
+
+func (r *Reporter) mustDeduper() *deduper {
+	if r.shared == nil {
+		r.shared = &reporterShared{}
+	}
+	r.shared.l.Lock()
+	defer r.shared.l.Unlock()
+	if r.shared.dedup == nil {
+		r.shared.dedup = &deduper{
+			rules:   make(map[string]dedupRule, 0),
+			states:  make(map[string]*dedupState, 0),
+			keyword: Fingerprint,
+		}
+	}
+	return r.shared.dedup
+}
+
+type dedupRule struct {
+	window time.Duration
+	limit  int
+}
+
+type dedupState struct {
+	keyword     string
+	count       int
+	first, last time.Time
+
+	// the last suppressed error, reported as summary by r when the window ends
+	suppressed int
+	e          error
+	context    map[string]interface{}
+	r          *Reporter
+	ctx        context.Context
+}
+
+type deduper struct {
+	l       sync.Mutex
+	rules   map[string]dedupRule
+	states  map[string]*dedupState
+	keyword func(e error) string
+}
+
+// allow reports whether e, saved by r in its mode, should be reported now.
+func (d *deduper) allow(r *Reporter, ctx context.Context, e error, context map[string]interface{}) bool {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	mode := r.mode
+	rule, ok := d.rules[mode]
+	if !ok {
+		if rule, ok = d.rules[""]; !ok {
+			return true
+		}
+	}
+
+	now := time.Now()
+	keyword := d.keyword(e)
+	key := mode + "\x00" + keyword
+	state, ok := d.states[key]
+	if !ok {
+		d.states[key] = &dedupState{
+			keyword: keyword,
+			count:   1,
+			first:   now,
+			last:    now,
+		}
+		time.AfterFunc(rule.window, func() {
+			d.summary(key)
+		})
+		return true
+	}
+
+	state.count++
+	state.last = now
+	if state.count <= rule.limit {
+		return true
+	}
+
+	state.suppressed++
+	state.e = e
+	state.r = r
+	state.ctx = ctx
+	state.context = make(map[string]interface{}, len(context)+4)
+	for k, v := range context {
+		state.context[k] = v
+	}
+	return false
+}
+
+// summary ends the window of key, and reports the suppressed error if any.
+func (d *deduper) summary(key string) {
+	d.l.Lock()
+	state, ok := d.states[key]
+	delete(d.states, key)
+	d.l.Unlock()
+
+	if !ok || state.suppressed == 0 {
+		return
+	}
+
+	state.context["dedup_keyword"] = state.keyword
+	state.context["dedup_count"] = state.count
+	state.context["dedup_first"] = state.first.Format(time.RFC3339Nano)
+	state.context["dedup_last"] = state.last.Format(time.RFC3339Nano)
+	// sampled and counted like other reports
+	state.r.report(state.ctx, state.e, state.context, true)
+}
@@ -0,0 +1,99 @@
+package errorx
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReporterDedup(t *testing.T) {
+	var (
+		l        sync.Mutex
+		reported []map[string]interface{}
+	)
+	rp := NewReporter("pro")
+	rp.AddModeHandler("pro", func(e error, context map[string]interface{}) {
+		l.Lock()
+		defer l.Unlock()
+		reported = append(reported, context)
+	})
+	rp.AddModeHandler("dev", func(e error, context map[string]interface{}) {
+		l.Lock()
+		defer l.Unlock()
+		reported = append(reported, context)
+	})
+	rp.SetDedup("pro", 200*time.Millisecond, 2)
+
+	for i := 0; i < 10; i++ {
+		rp.SaveError(dedupService(), map[string]interface{}{
+			"index": i,
+		})
+	}
+	// another error is not folded
+	rp.SaveError(NewFromString("connect to redis time out"), nil)
+	// other modes have no rule
+	for i := 0; i < 3; i++ {
+		rp.Mode("dev").SaveError(dedupService(), nil)
+	}
+
+	l.Lock()
+	if len(reported) != 6 {
+		fmt.Println(len(reported))
+		t.Fail()
+		l.Unlock()
+		return
+	}
+	l.Unlock()
+
+	time.Sleep(400 * time.Millisecond)
+
+	l.Lock()
+	defer l.Unlock()
+	if len(reported) != 7 {
+		fmt.Println(len(reported))
+		t.Fail()
+		return
+	}
+	summary := reported[6]
+	if summary["dedup_count"] != 10 || summary["index"] != 9 || summary["dedup_first"] == nil || summary["dedup_last"] == nil {
+		fmt.Println(summary)
+		t.Fail()
+		return
+	}
+}
+
+func dedupService() error {
+	return NewFromString("nil return")
+}
+
+func TestReporterDedupSummarySampledAndCounted(t *testing.T) {
+	var (
+		l       sync.Mutex
+		sampled int
+	)
+	m := NewMetrics()
+	rp := NewReporter("pro").SetMetrics(m)
+	rp.AddModeHandler("pro", func(e error, context map[string]interface{}) {})
+	rp.SetDedup("pro", 100*time.Millisecond, 1)
+	rp.SetSampler("pro", SamplerFunc(func(e error) (bool, float64) {
+		l.Lock()
+		defer l.Unlock()
+		sampled++
+		return true, 1
+	}))
+
+	for i := 0; i < 5; i++ {
+		rp.SaveError(dedupService(), nil)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	l.Lock()
+	defer l.Unlock()
+	labels := MetricLabels{Mode: "pro", Handler: "mode_handler"}
+	if sampled != 2 || m.Counter("reporter_handled", labels) != 2 || m.Counter("reporter_saved", MetricLabels{Mode: "pro"}) != 5 {
+		fmt.Println(sampled, m.Snapshot())
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,153 @@
+package errorx
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Sampler decides whether an error is reported.
+// rate is the probability errors like e are kept, in [0, 1], a report stands for 1/rate errors.
+type Sampler interface {
+	Sample(e error) (keep bool, rate float64)
+}
+
+// SamplerFunc adapts a function to Sampler.
+type SamplerFunc func(e error) (bool, float64)
+
+func (f SamplerFunc) Sample(e error) (bool, float64) {
+	return f(e)
+}
+
+// RateSampler keeps errors with probability rate.
+func RateSampler(rate float64) Sampler {
+	return SamplerFunc(func(e error) (bool, float64) {
+		return sample(rate)
+	})
+}
+
+// CodeSampler keeps service errors with the rate of their errcode, see IsServiceErr.
+// Other errors are sampled by fallback, nil fallback keeps them all.
+//
+//	// 10001 'balance not enough' is known and benign
+//	errorx.CodeSampler(map[int]float64{10001: 0.01}, nil)
+func CodeSampler(rates map[int]float64, fallback Sampler) Sampler {
+	return SamplerFunc(func(e error) (bool, float64) {
+		if se, ok := IsServiceErr(e); ok {
+			if rate, ok := rates[se.Errcode]; ok {
+				return sample(rate)
+			}
+		}
+		if fallback == nil {
+			return true, 1
+		}
+		return fallback.Sample(e)
+	})
+}
+
+// FirstNSampler keeps the first n occurrences of each error in a period, and the rest with probability rate.
+// Errors are identified by Fingerprint.
+//
+//	// every new error is reported, repeated ones 1%
+//	errorx.FirstNSampler(10, time.Hour, 0.01)
+func FirstNSampler(n int, period time.Duration, rate float64) Sampler {
+	return &firstNSampler{
+		n:       n,
+		period:  period,
+		rate:    rate,
+		windows: make(map[string]*sampleWindow, 0),
+	}
+}
+
+type sampleWindow struct {
+	start time.Time
+	count int
+}
+
+type firstNSampler struct {
+	n      int
+	period time.Duration
+	rate   float64
+
+	l       sync.Mutex
+	windows map[string]*sampleWindow
+	swept   time.Time
+}
+
+func (s *firstNSampler) Sample(e error) (bool, float64) {
+	fp := Fingerprint(e)
+	now := time.Now()
+
+	s.l.Lock()
+	s.sweep(now)
+	w, ok := s.windows[fp]
+	if !ok || now.Sub(w.start) >= s.period {
+		w = &sampleWindow{start: now}
+		s.windows[fp] = w
+	}
+	w.count++
+	count := w.count
+	s.l.Unlock()
+
+	if count <= s.n {
+		return true, 1
+	}
+	return sample(s.rate)
+}
+
+// sweep drops windows ended, at most once a period.
+func (s *firstNSampler) sweep(now time.Time) {
+	if now.Sub(s.swept) < s.period {
+		return
+	}
+	s.swept = now
+	for k, v := range s.windows {
+		if now.Sub(v.start) >= s.period {
+			delete(s.windows, k)
+		}
+	}
+}
+
+func sample(rate float64) (bool, float64) {
+	switch {
+	case rate >= 1:
+		return true, 1
+	case rate <= 0:
+		return false, 0
+	}
+	return rand.Float64() < rate, rate
+}
+
+// SetSampler samples errors of mode after deduplication, mode "" sets the sampler for modes without their own.
+// nil removes the sampler. Reports of sampled errors carry context:
+//
+//	sampled      whether the error is subject to a rate less than 1
+//	sample_rate  the probability it's kept, a report stands for 1/sample_rate errors
+func (r *Reporter) SetSampler(mode string, s Sampler) *Reporter {
+	if r.shared == nil {
+		r.shared = &reporterShared{}
+	}
+	r.shared.l.Lock()
+	defer r.shared.l.Unlock()
+	if s == nil {
+		delete(r.shared.samplers, mode)
+		return r
+	}
+	if r.shared.samplers == nil {
+		r.shared.samplers = make(map[string]Sampler, 0)
+	}
+	r.shared.samplers[mode] = s
+	return r
+}
+
+func (r *Reporter) sampler() Sampler {
+	if r.shared == nil {
+		return nil
+	}
+	r.shared.l.RLock()
+	defer r.shared.l.RUnlock()
+	if s, ok := r.shared.samplers[r.mode]; ok {
+		return s
+	}
+	return r.shared.samplers[""]
+}
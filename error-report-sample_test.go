@@ -0,0 +1,74 @@
+package errorx
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSampler(t *testing.T) {
+	if keep, rate := RateSampler(0).Sample(nil); keep || rate != 0 {
+		t.Fail()
+		return
+	}
+
+	s := CodeSampler(map[int]float64{10001: 0}, RateSampler(1))
+	if keep, _ := s.Sample(Wrap(NewServiceError("balance not enough", 10001))); keep {
+		t.Fail()
+		return
+	}
+	if keep, rate := s.Sample(NewServiceError("user not found", 10002)); !keep || rate != 1 {
+		t.Fail()
+		return
+	}
+
+	s = FirstNSampler(2, 100*time.Millisecond, 0)
+	var kept int
+	for i := 0; i < 5; i++ {
+		if keep, _ := s.Sample(sampleService()); keep {
+			kept++
+		}
+	}
+	if keep, _ := s.Sample(NewFromString("another error")); !keep || kept != 2 {
+		fmt.Println(kept)
+		t.Fail()
+		return
+	}
+	time.Sleep(150 * time.Millisecond)
+	if keep, _ := s.Sample(sampleService()); !keep {
+		t.Fail()
+		return
+	}
+}
+
+func TestReporterSampler(t *testing.T) {
+	var reported []map[string]interface{}
+	rp := NewReporter("pro")
+	rp.AddModeHandler("pro", func(e error, context map[string]interface{}) {
+		reported = append(reported, context)
+	})
+	rp.SetSampler("", SamplerFunc(func(e error) (bool, float64) {
+		return true, 0.5
+	}))
+	rp.SetSampler("pro", CodeSampler(map[int]float64{10001: 0}, nil))
+
+	rp.SaveError(Wrap(NewServiceError("balance not enough", 10001)), nil)
+	rp.SaveError(NewFromString("nil return"), nil)
+	if len(reported) != 1 || reported[0]["sampled"] != false || reported[0]["sample_rate"] != float64(1) {
+		fmt.Println(reported)
+		t.Fail()
+		return
+	}
+
+	rp.SetSampler("pro", nil)
+	rp.SaveError(NewFromString("nil return"), nil)
+	if len(reported) != 2 || reported[1]["sampled"] != true || reported[1]["sample_rate"] != 0.5 {
+		fmt.Println(reported)
+		t.Fail()
+		return
+	}
+}
+
+func sampleService() error {
+	return NewFromString("nil return")
+}
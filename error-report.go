@@ -2,6 +2,7 @@ package errorx
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -18,6 +19,9 @@ var DefaultHandler = func(e error, context map[string]interface{}) {
 	tmp["error_uuid"] = context["error_uuid"]
 	delete(context, "error_uuid")
 	tmp["message"] = Wrap(e).Error()
+	if attrs := Attrs(e); len(attrs) != 0 {
+		tmp["attrs"] = attrs
+	}
 	tmp["context"] = context
 
 	var buf = []byte("")
@@ -39,11 +43,40 @@ type Reporter struct {
 	HandleMode map[string]func(e error, context map[string]interface{})
 	l2         sync.RWMutex
 
-	renameOfContext string
+	// state shared by clones made by Mode(), and by method values like rp.ReportURLHandler
+	shared *reporterShared
+}
+
+type reporterShared struct {
+	l        sync.RWMutex
+	async    *asyncSender
+	dedup    *deduper
+	redactor *Redactor
+	samplers map[string]Sampler
+	// name of context in reports, set by SetContextName and config
+	contextName string
+	sinks       map[string][]Sink
+	config      *reporterConfig
+	metrics     *Metrics
 }
 
+// SetContextName renames context in reports of ReportURLHandler and DefaultHandler, it's shared by clones made by Mode().
 func (r *Reporter) SetContextName(name string) {
-	r.renameOfContext = name
+	if r.shared == nil {
+		r.shared = &reporterShared{}
+	}
+	r.shared.l.Lock()
+	defer r.shared.l.Unlock()
+	r.shared.contextName = name
+}
+
+func (r *Reporter) contextName() string {
+	if r.shared == nil {
+		return ""
+	}
+	r.shared.l.RLock()
+	defer r.shared.l.RUnlock()
+	return r.shared.contextName
 }
 func (r *Reporter) SetMode(mode string) {
 	r.mode = mode
@@ -57,16 +90,24 @@ func (r Reporter) ReportURLHandler(e error, context map[string]interface{}) {
 		DefaultHandler(NewFromStringf("reporter mode empty, please call er.Mode('pro') first"), context)
 		return
 	}
+	r.reportURL(r.c, r.Url[r.mode], e, context)
+}
 
+// reportURL posts error with context to url, context is renamed by SetContextName.
+func (r *Reporter) reportURL(c *http.Client, url string, e error, context map[string]interface{}) {
 	var tmp = make(map[string]interface{}, 0)
 
 	tmp["error_uuid"] = context["error_uuid"]
 	delete(context, "error_uuid")
 
 	tmp["message"] = Wrap(e).Error()
+	if attrs := Attrs(e); len(attrs) != 0 {
+		tmp["attrs"] = attrs
+	}
+	tmp["error"] = e
 
-	if r.renameOfContext != "" {
-		tmp[r.renameOfContext] = context
+	if contextName := r.contextName(); contextName != "" {
+		tmp[contextName] = context
 	} else {
 		tmp["context"] = context
 	}
@@ -77,14 +118,17 @@ func (r Reporter) ReportURLHandler(e error, context map[string]interface{}) {
 		DefaultHandler(Wrap(e), context)
 		return
 	}
-	req, er := http.NewRequest("POST", r.Url[r.mode], bytes.NewReader(buf))
-	req.Header.Set("Content-Type", "application/json")
+	if as := r.asyncSender(); as != nil && as.enqueue(url, buf) {
+		return
+	}
+	req, er := http.NewRequest("POST", url, bytes.NewReader(buf))
 	if er != nil {
 		context["reporter"] = er.Error()
 		DefaultHandler(Wrap(e), context)
 		return
 	}
-	resp, er := r.c.Do(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, er := c.Do(req)
 	if er != nil {
 		context["reporter"] = er.Error()
 		DefaultHandler(Wrap(e), context)
@@ -100,8 +144,11 @@ func (r Reporter) DefaultHandler(e error, context map[string]interface{}) {
 	tmp["error_uuid"] = context["error_uuid"]
 	delete(context, "error_uuid")
 	tmp["message"] = Wrap(e).Error()
-	if r.renameOfContext != "" {
-		tmp[r.renameOfContext] = context
+	if attrs := Attrs(e); len(attrs) != 0 {
+		tmp["attrs"] = attrs
+	}
+	if contextName := r.contextName(); contextName != "" {
+		tmp[contextName] = context
 	} else {
 		tmp["context"] = context
 	}
@@ -124,6 +171,8 @@ func NewReporter(mode string) *Reporter {
 		HandleMode: make(map[string]func(e error, context map[string]interface{})),
 		l1:         sync.RWMutex{},
 		l2:         sync.RWMutex{},
+
+		shared: &reporterShared{},
 	}
 }
 
@@ -137,7 +186,7 @@ func (r *Reporter) copy() *Reporter {
 		l1:         r.l1,
 		l2:         r.l2,
 
-		renameOfContext: r.renameOfContext,
+		shared: r.shared,
 	}
 	return clone
 }
@@ -160,33 +209,89 @@ func (r *Reporter) AddModeHandler(mode string, f func(e error, context map[strin
 
 // rp.Mode related, should call as r.Mode("dev").SaveError()
 func (r Reporter) SaveError(e error, context map[string]interface{}) string {
+	return r.saveError(nil, e, context)
+}
+
+// saveError saves e, ctx is passed to sinks, nil means context.Background().
+func (r *Reporter) saveError(ctx context.Context, e error, context map[string]interface{}) string {
+	return r.report(ctx, e, context, false)
+}
+
+// report saves e, or the summary of suppressed errors from deduplication, which is neither counted as saved nor
+// deduplicated again.
+func (r *Reporter) report(ctx context.Context, e error, context map[string]interface{}, summary bool) string {
 L:
 	switch v := e.(type) {
 	case Error:
 		break L
 	case error:
-		return r.SaveError(NewFromString(string(fmt.Sprintf("err '%s' \n %s", v.Error(), debug.Stack()))), context)
+		return r.report(ctx, NewFromString(string(fmt.Sprintf("err '%s' \n %s", v.Error(), debug.Stack()))), context, summary)
 	}
 
 	if context == nil {
 		context = make(map[string]interface{}, 0)
 	}
 
-	var handler func(e error, context map[string]interface{})
+	var (
+		handler func(e error, context map[string]interface{})
+		// label of metrics
+		handlerName = "mode_handler"
+	)
 	// judge whether exist handler for mode
 	func() {
-		var ok bool
 		r.l2.RLock()
 		defer r.l2.RUnlock()
-		handler, ok = r.HandleMode[r.mode]
-		if !ok {
-			handler = DefaultHandler
-		}
+		handler = r.HandleMode[r.mode]
 	}()
+	// sinks work besides the handler of mode, and replace the url of config and DefaultHandler
+	if sinks, rc := r.sinks(r.mode); len(sinks) != 0 || rc != nil {
+		if handler == nil {
+			handlerName = "sinks"
+		}
+		handler = r.sinkHandler(ctx, sinks, rc, handler)
+	}
+	if handler == nil {
+		handler = r.configHandler(r.mode)
+		handlerName = "url"
+	}
+	if handler == nil {
+		handler = DefaultHandler
+		handlerName = "default"
+	}
+	rd := r.redactor()
+	context = rd.RedactMap(context)
+	if x, ok := e.(Error); ok {
+		e = rd.RedactError(x)
+	}
+
+	m := r.metrics()
+	labels := MetricLabels{Mode: r.mode, Code: ErrorCode(e)}
+	if !summary {
+		m.Add("reporter_saved", labels, 1)
+	}
+
 	u, _ := NewV4()
 	errorUUID := u.String()
+	if d := r.deduper(); d != nil && !summary && !d.allow(r, ctx, e, context) {
+		m.Add("reporter_deduplicated", labels, 1)
+		return errorUUID
+	}
+	if s := r.sampler(); s != nil {
+		keep, rate := s.Sample(e)
+		if !keep {
+			m.Add("reporter_sampled_out", labels, 1)
+			return errorUUID
+		}
+		context["sampled"] = rate < 1
+		context["sample_rate"] = rate
+	}
 	context["error_uuid"] = errorUUID
+
+	start := time.Now()
 	handler(Wrap(e), context)
+	labels.Handler = handlerName
+	m.Add("reporter_handled", labels, 1)
+	m.Observe("reporter_handle_seconds", MetricLabels{Mode: r.mode, Handler: handlerName}, time.Since(start))
 
 	return errorUUID
 }
@@ -206,12 +311,22 @@ L:
 		context = make(map[string]interface{}, 0)
 	}
 
+	rd := r.redactor()
+	context = rd.RedactMap(context)
+	if x, ok := e.(Error); ok {
+		e = rd.RedactError(x)
+	}
+
 	var tmp = make(map[string]interface{}, 0)
 
 	u, _ := uuid.NewV4()
 	errUUID := u.String()
 	tmp["error_uuid"] = errUUID
 	tmp["message"] = Wrap(e).Error()
+	if attrs := Attrs(e); len(attrs) != 0 {
+		tmp["attrs"] = attrs
+	}
+	tmp["error"] = e
 	tmp["context"] = context
 	buf, e := json.Marshal(tmp)
 	if e != nil {
@@ -233,12 +348,22 @@ L:
 		context = make(map[string]interface{}, 0)
 	}
 
+	rd := currentRedactor()
+	context = rd.RedactMap(context)
+	if x, ok := e.(Error); ok {
+		e = rd.RedactError(x)
+	}
+
 	var tmp = make(map[string]interface{}, 0)
 
 	u, _ := uuid.NewV4()
 	errUUID := u.String()
 	tmp["error_uuid"] = errUUID
 	tmp["message"] = Wrap(e).Error()
+	if attrs := Attrs(e); len(attrs) != 0 {
+		tmp["attrs"] = attrs
+	}
+	tmp["error"] = e
 	tmp["context"] = context
 	buf, e := json.Marshal(tmp)
 	if e != nil {
@@ -260,12 +385,22 @@ L:
 		context = make(map[string]interface{}, 0)
 	}
 
+	rd := r.redactor()
+	context = rd.RedactMap(context)
+	if x, ok := e.(Error); ok {
+		e = rd.RedactError(x)
+	}
+
 	var tmp = make(map[string]interface{}, 0)
 
 	u, _ := uuid.NewV4()
 	errUUID := u.String()
 	tmp["error_uuid"] = errUUID
 	tmp["message"] = Wrap(e).Error()
+	if attrs := Attrs(e); len(attrs) != 0 {
+		tmp["attrs"] = attrs
+	}
+	tmp["error"] = e
 	tmp["context"] = context
 	buf, e := json.MarshalIndent(tmp, prefix, indent)
 	if e != nil {
@@ -287,12 +422,22 @@ L:
 		context = make(map[string]interface{}, 0)
 	}
 
+	rd := currentRedactor()
+	context = rd.RedactMap(context)
+	if x, ok := e.(Error); ok {
+		e = rd.RedactError(x)
+	}
+
 	var tmp = make(map[string]interface{}, 0)
 
 	u, _ := uuid.NewV4()
 	errUUID := u.String()
 	tmp["error_uuid"] = errUUID
 	tmp["message"] = Wrap(e).Error()
+	if attrs := Attrs(e); len(attrs) != 0 {
+		tmp["attrs"] = attrs
+	}
+	tmp["error"] = e
 	tmp["context"] = context
 	buf, e := json.MarshalIndent(tmp, prefix, indent)
 	if e != nil {
@@ -300,3 +445,21 @@ L:
 	}
 	return errUUID, buf, nil
 }
+
+// ParseJSON parses json buf made by JSON, JSONIndent or ReportURLHandler.
+// returns errorUUID, error, context, parse-error
+// The returned error is rebuilt from field 'error', its stack, header and service error are the same as the reported one.
+func ParseJSON(buf []byte) (string, Error, map[string]interface{}, error) {
+	var tmp struct {
+		ErrorUUID string                 `json:"error_uuid"`
+		Error     *Error                 `json:"error"`
+		Context   map[string]interface{} `json:"context"`
+	}
+	if e := json.Unmarshal(buf, &tmp); e != nil {
+		return "", Empty(), nil, Wrap(e)
+	}
+	if tmp.Error == nil {
+		return tmp.ErrorUUID, Empty(), tmp.Context, NewFromString("field 'error' not found, json might be made by an old version")
+	}
+	return tmp.ErrorUUID, *tmp.Error, tmp.Context, nil
+}
@@ -1,10 +1,12 @@
 package errorCollection
 
 import (
+	"context"
 	"github.com/fwhezfwhez/errorx"
 	queue "github.com/fwhezfwhez/go-queue"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,26 +14,110 @@ type ErrorBox *queue.Queue
 type ErrorHandler func(e error)
 type ErrorHandlerWithContextInSeries func(e error, ctx *Context) (next bool)
 
+// Policy decides what Add does when the queue is full.
+type Policy int
+
+const (
+	// the oldest error in queue is dropped to make space, the default
+	PolicyDropOldest Policy = iota
+	// the error added is dropped
+	PolicyDropNewest
+	// Add waits until a worker makes space. Without handles running, the queue grows instead, as nothing makes space
+	PolicyBlock
+	// Add waits AddTimeout at most, then the error added is dropped
+	PolicyTimeout
+)
+
+// CollectionOption configures an ErrorCollection.
+type CollectionOption struct {
+	// number of goroutines handling errors, default 1
+	Workers int
+	// capacity of the queue, default 200
+	QueueSize int
+	// what Add does when the queue is full, default PolicyDropOldest
+	Policy Policy
+	// used by PolicyTimeout, default 1s
+	AddTimeout time.Duration
+	// when set, errors are written into the spool before being queued, and acknowledged after being handled,
+	// errors it holds from last run are queued first, see OpenSpool
+	Spool *Spool
+	// where metrics are recorded, default errorx.DefaultMetrics, see errorx.Metrics
+	Metrics *errorx.Metrics
+}
+
 type ErrorCollection struct {
 	errors                              ErrorBox                          // store errors in queue
 	ErrorHandleChain                    []ErrorHandler                    // handler to deal with error
 	ErrorHandleChainWithContextInSeires []ErrorHandlerWithContextInSeries // handler with a context and a flag 'next' to decide whether to handle next handler
 	M                                   *sync.Mutex                       // field lock RWlock
-	CatchErrorChan                      chan error                        // when error in queue,it will be put into catchErrorChan
+	CatchErrorChan                      chan error                        // errors are put into it by CatchError, Deprecated
 	AutoHandleChan                      chan int                          // used to close the channel
+
+	opt CollectionOption
+	// notify wakes a worker when errors come, space wakes an Add blocked when errors leave
+	notify chan struct{}
+	space  chan struct{}
+	// consumers registered by Handle, HandleInSeries and HandleChain, each error is passed to all of them
+	consumers []consumer
+	running   bool
+	wg        sync.WaitGroup
+	dropped   int64
+
+	// closed by Shutdown, Add rejects errors and workers return when the queue is empty
+	closing chan struct{}
+	// guarded by the queue lock, so no error is pushed after Shutdown starts draining
+	closed bool
+	// closed when Shutdown finishes, shutDropped and shutErr are the result
+	shut        chan struct{}
+	shutDropped int
+	shutErr     error
 }
 
-// New a error collection
-func NewCollection() *ErrorCollection {
+// New a error collection. Without opt, it's handled by a worker, with a queue of 200 errors, and Add drops the oldest error when the queue is full.
+//
+//	ec := errorCollection.NewCollection(errorCollection.CollectionOption{
+//	    Workers:   4,
+//	    QueueSize: 10000,
+//	    Policy:    errorCollection.PolicyBlock,
+//	})
+func NewCollection(opt ...CollectionOption) *ErrorCollection {
 	log.SetFlags(log.Llongfile | log.LstdFlags)
-	return &ErrorCollection{
-		errors:                              queue.NewCap(200),
+	var o CollectionOption
+	if len(opt) != 0 {
+		o = opt[0]
+	}
+	if o.Workers <= 0 {
+		o.Workers = 1
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 200
+	}
+	if o.AddTimeout <= 0 {
+		o.AddTimeout = time.Second
+	}
+	ec := &ErrorCollection{
+		errors:                              queue.NewCap(o.QueueSize),
 		ErrorHandleChain:                    make([]ErrorHandler, 0, 10),
 		ErrorHandleChainWithContextInSeires: make([]ErrorHandlerWithContextInSeries, 0, 10),
 		CatchErrorChan:                      make(chan error, 1),
 		AutoHandleChan:                      make(chan int, 1),
 		M:                                   &sync.Mutex{},
+		opt:                                 o,
+		notify:                              make(chan struct{}, 1),
+		space:                               make(chan struct{}, 1),
+		closing:                             make(chan struct{}),
+	}
+	if o.Spool != nil {
+		// errors replayed are queued even if they're more than QueueSize
+		q := (*queue.Queue)(ec.errors)
+		for _, v := range o.Spool.takeReplay() {
+			q.Push(v)
+		}
+		if q.Length() != 0 {
+			log.Printf("replay %d errors from spool\n", q.Length())
+		}
 	}
+	return ec
 }
 func Default() *ErrorCollection {
 	e := NewCollection()
@@ -52,67 +138,229 @@ func (ec *ErrorCollection) Length() int {
 	return (*queue.Queue)(ec.errors).Length()
 }
 
-// Add an error into collect
+// Dropped returns the number of errors dropped, by Add because the queue was full or the collection was shut down,
+// and by Shutdown timing out.
+func (ec *ErrorCollection) Dropped() int64 {
+	return atomic.LoadInt64(&ec.dropped)
+}
+
+type consumer struct {
+	// label of metrics
+	name string
+	f    func(e error)
+	// pipelines record metrics of their stages, rather than of themselves
+	staged bool
+}
+
+func (ec *ErrorCollection) metrics() *errorx.Metrics {
+	if ec.opt.Metrics != nil {
+		return ec.opt.Metrics
+	}
+	return errorx.DefaultMetrics
+}
+
+// drop counts e as dropped.
+func (ec *ErrorCollection) drop(e error) {
+	atomic.AddInt64(&ec.dropped, 1)
+	ec.metrics().Add("collection_dropped", errorx.MetricLabels{Code: errorx.ErrorCode(e)}, 1)
+}
+
+// Add an error into collect.
+// When the queue is full, it blocks, drops an error or times out, according to the policy, see CollectionOption.
 func (ec *ErrorCollection) Add(e error) {
+	if e == nil {
+		return
+	}
+	var (
+		deadline <-chan time.Time
+		// closed by CloseHandles, an Add blocked rechecks whether workers are running
+		stopped chan int
+	)
+	for {
+		if ok, closed := ec.push(e, false); ok {
+			return
+		} else if closed {
+			ec.drop(e)
+			return
+		}
+		switch ec.opt.Policy {
+		case PolicyDropNewest:
+			ec.drop(e)
+			return
+		case PolicyDropOldest:
+			if old := ec.Pop(); old != nil {
+				ec.drop(old)
+			}
+			continue
+		case PolicyBlock:
+			var running bool
+			if stopped, running = ec.handling(); !running {
+				if _, closed := ec.push(e, true); closed {
+					ec.drop(e)
+				}
+				return
+			}
+		case PolicyTimeout:
+			if deadline == nil {
+				timer := time.NewTimer(ec.opt.AddTimeout)
+				defer timer.Stop()
+				deadline = timer.C
+			}
+		}
+
+		select {
+		case <-ec.space:
+		case <-ec.closing:
+		case <-stopped:
+		case <-deadline:
+			ec.drop(e)
+			return
+		}
+	}
+}
+
+// handling reports whether workers are running, and returns the channel closed when they're stopped by CloseHandles.
+func (ec *ErrorCollection) handling() (chan int, bool) {
 	ec.M.Lock()
 	defer ec.M.Unlock()
+	return ec.AutoHandleChan, ec.running
+}
 
-	if len(ec.CatchErrorChan) < cap(ec.CatchErrorChan) {
-		ec.CatchErrorChan <- e
-	} else {
-		(*queue.Queue)(ec.errors).Push(e)
+// push adds e if the queue isn't full, or force is true, and the collection isn't shut down.
+// e is written into the spool under the queue lock, so the spool keeps the order of the queue.
+func (ec *ErrorCollection) push(e error, force bool) (ok bool, closed bool) {
+	q := (*queue.Queue)(ec.errors)
+	ec.GetQueueLock().Lock()
+	if ec.closed {
+		ec.GetQueueLock().Unlock()
+		return false, true
+	}
+	if !force && q.Length() >= ec.opt.QueueSize {
+		ec.GetQueueLock().Unlock()
+		return false, false
 	}
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("catch a panic：%s\n", r)
+	item := spooled{e: e}
+	if ec.opt.Spool != nil {
+		seq, er := ec.opt.Spool.append(e)
+		if er != nil {
+			log.Printf("spool error fail, err=%s\n", er.Error())
 		}
-	}()
+		item.seq = seq
+	}
+	q.Push(item)
+	ec.GetQueueLock().Unlock()
+	ec.metrics().Add("collection_queued", errorx.MetricLabels{Code: errorx.ErrorCode(e)}, 1)
+
+	signal(ec.notify)
+	return true, false
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
 }
 
 // This is a self design  function to handle the inner errors collected via a single handler typed 'ErrorHandler'
+// Handle, HandleInSeries and HandleChain can be used together, each error is passed to all of them.
 func (ec *ErrorCollection) Handle(f ErrorHandler) {
+	ec.consume(consumer{name: "handle", f: func(e error) {
+		f(e)
+	}})
+}
+
+// this is a self design function to handle the inner errors collected via a single handler typed 'ErrorHandlerWithContextInSeries'
+// Each error comes with a new context.
+func (ec *ErrorCollection) HandleInSeries(f ErrorHandlerWithContextInSeries) {
+	ec.consume(consumer{name: "handle_in_series", f: func(e error) {
+		ctx := NewContext()
+		_ = f(e, ctx)
+	}})
+}
+
+// consume registers c to handle every error, and starts workers if they're not running.
+func (ec *ErrorCollection) consume(c consumer) {
 	ec.M.Lock()
+	defer ec.M.Unlock()
+	if ec.running {
+		ec.consumers = append(ec.consumers, c)
+		return
+	}
+	// handles closed before are dropped, workers stopping may still be using them
+	ec.consumers = []consumer{c}
+	ec.start()
+}
+
+// start starts workers, ec.M is held.
+func (ec *ErrorCollection) start() {
+	ec.running = true
 	ec.newAutoHandleChan()
-	ec.CatchError()
-	ec.M.Unlock()
-	go func() {
-		log.Println("handle routine starts,use ec.CloseHandles to stop")
-	L:
-		for {
+	log.Printf("handle routines start with %d workers, use ec.CloseHandles to stop\n", ec.opt.Workers)
+	for i := 0; i < ec.opt.Workers; i++ {
+		ec.wg.Add(1)
+		go ec.work(ec.AutoHandleChan)
+	}
+}
+
+// work handles errors until stop is closed, it sleeps on notify when the queue is empty.
+// After Shutdown starts, it returns once the queue is empty.
+func (ec *ErrorCollection) work(stop chan int) {
+	defer ec.wg.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		item, ok := ec.pop()
+		if !ok {
 			select {
-			case <-ec.AutoHandleChan:
-				log.Println("handle finish by auto handle chan")
-				break L
-			case e := <-ec.CatchErrorChan:
-				f(e)
+			case <-stop:
+				return
+			case <-ec.closing:
+				return
+			case <-ec.notify:
 			}
+			continue
 		}
-	}()
+		ec.dispatch(item.e)
+		ec.ack(item.seq)
+	}
 }
 
-// this is a self design function to handle the inner errors collected via a single handler typed 'ErrorHandlerWithContextInSeries'
-// DO not Use handler in series typed 'ErrorHandlerWithContextInSeries' together with basic typed 'ErrorHandler', because they share the error channel causing a single error
-// could be handler only by one the them.
-func (ec *ErrorCollection) HandleInSeries(f ErrorHandlerWithContextInSeries) {
+// ack acknowledges an error handled or dropped to the spool.
+func (ec *ErrorCollection) ack(seq uint64) {
+	if ec.opt.Spool == nil {
+		return
+	}
+	if er := ec.opt.Spool.ack(seq); er != nil {
+		log.Printf("ack spooled error %d fail, err=%s\n", seq, er.Error())
+	}
+}
+
+func (ec *ErrorCollection) dispatch(e error) {
 	ec.M.Lock()
-	ec.newAutoHandleChan()
-	ec.CatchError()
+	consumers := ec.consumers
 	ec.M.Unlock()
-	go func() {
-		log.Println("handle routine starts,use ec.CloseHandles to stop")
-	L:
-		for {
-			select {
-			case <-ec.AutoHandleChan:
-				log.Println("handle finish by auto handle chan")
-				break L
-			case e := <-ec.CatchErrorChan:
-				// next
-				ctx := NewContext()
-				_ = f(e, ctx)
-			}
+	m := ec.metrics()
+	code := errorx.ErrorCode(e)
+	for _, c := range consumers {
+		start := time.Now()
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("catch a panic：%v\n", r)
+				}
+			}()
+			c.f(e)
+		}()
+		if c.staged {
+			continue
 		}
-	}()
+		m.Add("collection_handled", errorx.MetricLabels{Handler: c.name, Code: code}, 1)
+		m.Observe("collection_handle_seconds", errorx.MetricLabels{Handler: c.name}, time.Since(start))
+	}
 }
 
 func (ec *ErrorCollection) safeNewAutoHandleChan() {
@@ -124,10 +372,84 @@ func (ec *ErrorCollection) newAutoHandleChan() {
 	ec.AutoHandleChan = make(chan int, 1)
 }
 
+// CloseHandles stops workers after errors they're handling, errors left stay in queue, use Shutdown to handle them before exit.
+// It's safe to call it more than once.
+// Calling Handle, HandleInSeries or HandleChain again restarts handling, without handles registered before.
 func (ec *ErrorCollection) CloseHandles() {
 	ec.M.Lock()
 	defer ec.M.Unlock()
+	if !ec.running {
+		return
+	}
+	ec.running = false
 	close(ec.AutoHandleChan)
+	log.Println("handle routines stop by auto handle chan")
+}
+
+// Shutdown stops accepting errors, and waits for errors in queue to be handled, by handles running,
+// or by the handler chain when no handle is running, see HandleChain.
+// When ctx is done first, errors left are dropped and ctx.Err() is returned at once, handlers still running are not waited for,
+// workers stop after they return.
+// With a spool, errors left are kept in it rather than dropped, and replayed next time. So are errors of handlers
+// still running when the spool is closed, their acknowledgements are ignored.
+// dropped is the number of errors dropped since Shutdown started, including those added after it, see Dropped.
+// Calling it again, or from several goroutines, waits for the first call and returns its result.
+func (ec *ErrorCollection) Shutdown(ctx context.Context) (dropped int, err error) {
+	ec.M.Lock()
+	if ec.shut != nil {
+		shut := ec.shut
+		ec.M.Unlock()
+		select {
+		case <-shut:
+			return ec.shutDropped, ec.shutErr
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	ec.shut = make(chan struct{})
+	before := atomic.LoadInt64(&ec.dropped)
+
+	ec.GetQueueLock().Lock()
+	ec.closed = true
+	ec.GetQueueLock().Unlock()
+	close(ec.closing)
+
+	if !ec.running && len(ec.ErrorHandleChain)+len(ec.ErrorHandleChainWithContextInSeires) != 0 {
+		ec.consumers = []consumer{{name: "handle_chain", f: ec.handleChain}}
+		ec.start()
+	}
+	ec.M.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ec.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	ec.CloseHandles()
+
+	// errors left, because ctx is done or no handle is running
+	var left []error
+	q := (*queue.Queue)(ec.errors)
+	ec.GetQueueLock().Lock()
+	for v := q.Pop(); v != nil; v = q.Pop() {
+		left = append(left, v.(spooled).e)
+	}
+	ec.GetQueueLock().Unlock()
+	if ec.opt.Spool == nil {
+		for _, e := range left {
+			ec.drop(e)
+		}
+	}
+
+	ec.shutDropped = int(atomic.LoadInt64(&ec.dropped) - before)
+	ec.shutErr = err
+	close(ec.shut)
+	return ec.shutDropped, ec.shutErr
 }
 
 func (ec *ErrorCollection) IfErrorChanFull() bool {
@@ -140,6 +462,7 @@ func (ec *ErrorCollection) IfErrorChanFull() bool {
 // Handle the error queue one by one  by those handler added
 // How to add a handler>
 // ec.AddHandler(Logger(),Panic(),SendEmail()) ...
+// Handlers with context run after basic handlers, in series, until one returns false.
 // How to make handler routine dependent?
 // ** When should do like this?**
 // ** When you realize the handler might risk timing out or**
@@ -153,34 +476,27 @@ func (ec *ErrorCollection) IfErrorChanFull() bool {
 //			}
 //		}
 func (ec *ErrorCollection) HandleChain() {
-	ec.newAutoHandleChan()
-	ec.CatchError()
-	go func() {
-		log.Println("handleChain routine starts,use ec.CloseHandles to stop")
-	L:
-		for {
-			select {
-			case e := <-ec.CatchErrorChan:
-				// handle basic handle chains
-				for _, f := range ec.ErrorHandleChain {
-					f(e)
-				}
+	ec.consume(consumer{name: "handle_chain", f: ec.handleChain})
+}
 
-				// handle handle chains with a context and next control
-				ctx := NewContext()
-				for _, f := range ec.ErrorHandleChainWithContextInSeires {
-					next := f(e, ctx)
-					if !next {
-						break L
-					}
-				}
-			case <-ec.AutoHandleChan:
-				log.Println("handleChain finish by auto handle chan")
-				break L
-			}
-		}
-	}()
+func (ec *ErrorCollection) handleChain(e error) {
+	ec.M.Lock()
+	chain := ec.ErrorHandleChain
+	chainWithContext := ec.ErrorHandleChainWithContextInSeires
+	ec.M.Unlock()
+
+	// handle basic handle chains
+	for _, f := range chain {
+		f(e)
+	}
 
+	// handle handle chains with a context and next control
+	ctx := NewContext()
+	for _, f := range chainWithContext {
+		if next := f(e, ctx); !next {
+			break
+		}
+	}
 }
 
 // Add handler to handler chain
@@ -199,27 +515,43 @@ func (ec *ErrorCollection) AddHandlerWithContext(handler ...ErrorHandlerWithCont
 
 // Clear errors in collection
 func (ec *ErrorCollection) Clear() {
-	ec.M.Lock()
-	defer ec.M.Unlock()
-	ec.errors = ErrorBox(queue.NewCap(500))
+	for {
+		item, ok := ec.pop()
+		if !ok {
+			return
+		}
+		ec.ack(item.seq)
+	}
 }
 
 // Pop an error.
 // The popped error is from queue' head.
 // When use Pop(), it means the error has been dealed and deleted from the queue
 func (ec *ErrorCollection) Pop() error {
+	item, ok := ec.pop()
+	if !ok {
+		return nil
+	}
+	ec.ack(item.seq)
+	return item.e
+}
+
+func (ec *ErrorCollection) pop() (spooled, bool) {
 	q := (*queue.Queue)(ec.errors)
 	ec.GetQueueLock().Lock()
-	defer ec.GetQueueLock().Unlock()
-	//if ec.Length() > 0 {
 	v := q.Pop()
-	if v != nil {
-		e := v.(error)
-		return e
+	left := q.Length()
+	ec.GetQueueLock().Unlock()
+
+	if v == nil {
+		return spooled{}, false
 	}
-	return nil
-	//}
-	return nil
+	signal(ec.space)
+	// wake another worker for the rest
+	if left > 0 {
+		signal(ec.notify)
+	}
+	return v.(spooled), true
 }
 
 // Get an error
@@ -229,38 +561,37 @@ func (ec *ErrorCollection) GetError() error {
 	q := (*queue.Queue)(ec.errors)
 	if ec.Length() != 0 {
 		h, _ := q.SafeValidHead()
-		return errorx.Wrap(h.(error))
+		return errorx.Wrap(h.(spooled).e)
 	}
 	return nil
 }
 
-// When an error in , it will be pop into a chanel waiting for handling
+// CatchError puts errors into CatchErrorChan for those receiving from it by themselves.
+// Deprecated: use Handle, it doesn't need a goroutine receiving from a channel.
 func (ec *ErrorCollection) CatchError() <-chan error {
-	go func() {
-	L:
-		for {
-			select {
-			case <-ec.AutoHandleChan:
-				log.Println("close error catching by auto handle chan")
-				break L
-			default:
-				ec.M.Lock()
-				if x := ec.Pop(); x != nil {
-					ec.CatchErrorChan <- x
-				}
-				ec.M.Unlock()
-			}
-			time.Sleep(200 * time.Millisecond)
+	ec.M.Lock()
+	defer ec.M.Unlock()
+	if !ec.running {
+		ec.consumers = nil
+		ec.start()
+	}
+	stop := ec.AutoHandleChan
+	ec.consumers = append(ec.consumers, consumer{name: "catch_error", f: func(e error) {
+		select {
+		case ec.CatchErrorChan <- e:
+		case <-stop:
+			ec.drop(e)
 		}
-	}()
+	}})
 	return ec.CatchErrorChan
 }
 
-// Logger records error msg in log without modifying error queue.
+// Logger records error msg with its stack in log without modifying error queue.
 func Logger() func(e error) {
 	return func(e error) {
 		log.SetFlags(log.LstdFlags | log.Llongfile)
-		log.Println(e)
+		// %v of errorx.Error is the root message only
+		log.Println(e.Error())
 	}
 }
 
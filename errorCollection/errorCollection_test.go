@@ -1,9 +1,12 @@
 package errorCollection
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/fwhezfwhez/errorx"
 	"log"
+	"os"
 	"runtime"
 	"strconv"
 	"strings"
@@ -132,3 +135,289 @@ func TestHandlerChain2(t *testing.T) {
 	ec.CloseHandles()
 	time.Sleep(4 * time.Second)
 }
+
+// Test errors are handled as soon as they come, by all handles
+func TestWorkers(t *testing.T) {
+	ec := NewCollection(CollectionOption{Workers: 4, QueueSize: 1000})
+
+	var (
+		l        sync.Mutex
+		handled  int
+		inSeries int
+		chained  int
+		done     = make(chan struct{})
+	)
+	ec.AddHandler(func(e error) {
+		l.Lock()
+		defer l.Unlock()
+		chained++
+	})
+	ec.Handle(func(e error) {
+		l.Lock()
+		defer l.Unlock()
+		handled++
+		if handled == 1000 {
+			close(done)
+		}
+	})
+	ec.HandleInSeries(func(e error, ctx *Context) bool {
+		l.Lock()
+		defer l.Unlock()
+		inSeries++
+		return true
+	})
+	ec.HandleChain()
+
+	for i := 0; i < 1000; i++ {
+		ec.Add(errorx.NewFromString(strconv.Itoa(i) + ":error"))
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("time out")
+	}
+	ec.CloseHandles()
+	ec.wg.Wait()
+
+	l.Lock()
+	defer l.Unlock()
+	if handled != 1000 || inSeries != 1000 || chained != 1000 {
+		fmt.Println(handled, inSeries, chained)
+		t.Fail()
+		return
+	}
+
+	// restart
+	restarted := make(chan error, 1)
+	ec.Handle(func(e error) {
+		restarted <- e
+	})
+	ec.Add(errorx.NewFromString("restart error"))
+	select {
+	case e := <-restarted:
+		if !strings.Contains(e.Error(), "restart error") {
+			t.Fail()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("time out")
+	}
+	ec.CloseHandles()
+}
+
+func TestPolicy(t *testing.T) {
+	ec := NewCollection(CollectionOption{QueueSize: 2, Policy: PolicyDropNewest})
+	for i := 0; i < 5; i++ {
+		ec.Add(errorx.NewFromString(strconv.Itoa(i) + ":error"))
+	}
+	if ec.SafeLength() != 2 || ec.Dropped() != 3 || !strings.Contains(ec.Pop().Error(), "0:error") {
+		fmt.Println(ec.SafeLength(), ec.Dropped())
+		t.Fail()
+		return
+	}
+
+	ec = NewCollection(CollectionOption{QueueSize: 2, Policy: PolicyDropOldest})
+	for i := 0; i < 5; i++ {
+		ec.Add(errorx.NewFromString(strconv.Itoa(i) + ":error"))
+	}
+	if ec.SafeLength() != 2 || ec.Dropped() != 3 || !strings.Contains(ec.Pop().Error(), "3:error") {
+		fmt.Println(ec.SafeLength(), ec.Dropped())
+		t.Fail()
+		return
+	}
+
+	ec = NewCollection(CollectionOption{QueueSize: 1, Policy: PolicyTimeout, AddTimeout: 50 * time.Millisecond})
+	ec.Add(errorx.NewFromString("0:error"))
+	start := time.Now()
+	ec.Add(errorx.NewFromString("1:error"))
+	if time.Since(start) < 50*time.Millisecond || ec.Dropped() != 1 {
+		fmt.Println(time.Since(start), ec.Dropped())
+		t.Fail()
+		return
+	}
+
+	// Add blocks until a worker makes space
+	ec = NewCollection(CollectionOption{QueueSize: 1, Policy: PolicyBlock})
+	var (
+		release = make(chan struct{})
+		taken   = make(chan struct{}, 3)
+	)
+	ec.Handle(func(e error) {
+		taken <- struct{}{}
+		<-release
+	})
+	ec.Add(errorx.NewFromString("0:error"))
+	<-taken
+	ec.Add(errorx.NewFromString("1:error"))
+	added := make(chan struct{})
+	go func() {
+		ec.Add(errorx.NewFromString("2:error"))
+		close(added)
+	}()
+	select {
+	case <-added:
+		t.Fatal("Add should block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("time out")
+	}
+	ec.CloseHandles()
+	if ec.Dropped() != 0 {
+		t.Fail()
+	}
+
+	// without handles running, nothing makes space, so the queue grows rather than blocking
+	ec = NewCollection(CollectionOption{QueueSize: 1, Policy: PolicyBlock})
+	for i := 0; i < 3; i++ {
+		ec.Add(errorx.NewFromString(strconv.Itoa(i) + ":error"))
+	}
+	if ec.SafeLength() != 3 || ec.Dropped() != 0 {
+		fmt.Println(ec.SafeLength(), ec.Dropped())
+		t.Fail()
+		return
+	}
+}
+
+// an Add blocked before CloseHandles returns once workers stop, and the queue grows
+func TestPolicyBlockCloseHandles(t *testing.T) {
+	ec := NewCollection(CollectionOption{QueueSize: 1, Policy: PolicyBlock})
+	var (
+		release = make(chan struct{})
+		taken   = make(chan struct{}, 1)
+	)
+	defer close(release)
+	ec.Handle(func(e error) {
+		taken <- struct{}{}
+		<-release
+	})
+	ec.Add(errorx.NewFromString("0:error"))
+	<-taken
+	ec.Add(errorx.NewFromString("1:error"))
+
+	added := make(chan struct{})
+	go func() {
+		ec.Add(errorx.NewFromString("2:error"))
+		close(added)
+	}()
+	select {
+	case <-added:
+		t.Fatal("Add should block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	ec.CloseHandles()
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Add is still blocked after CloseHandles")
+	}
+	if ec.SafeLength() != 2 || ec.Dropped() != 0 {
+		fmt.Println(ec.SafeLength(), ec.Dropped())
+		t.Fail()
+		return
+	}
+}
+
+func TestPolicyDefault(t *testing.T) {
+	// Add never blocks by default, even if no handle is running
+	ec := NewCollection()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 300; i++ {
+			ec.Add(errorx.NewFromString(strconv.Itoa(i) + ":error"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Add blocks")
+	}
+	if ec.SafeLength() != 200 || ec.Dropped() != 100 || !strings.Contains(ec.Pop().Error(), "100:error") {
+		fmt.Println(ec.SafeLength(), ec.Dropped())
+		t.Fail()
+		return
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ec := NewCollection(CollectionOption{QueueSize: 100})
+	var (
+		l       sync.Mutex
+		handled int
+	)
+	ec.AddHandler(func(e error) {
+		l.Lock()
+		defer l.Unlock()
+		handled++
+	})
+	for i := 0; i < 10; i++ {
+		ec.Add(errorx.NewFromString(strconv.Itoa(i) + ":error"))
+	}
+
+	// errors in queue are drained by the handler chain, and Shutdown from several goroutines return the same result
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dropped, e := ec.Shutdown(context.Background())
+			if dropped != 0 || e != nil {
+				fmt.Println(dropped, e)
+				t.Fail()
+			}
+		}()
+	}
+	wg.Wait()
+	l.Lock()
+	if handled != 10 {
+		fmt.Println(handled)
+		t.Fail()
+	}
+	l.Unlock()
+
+	// errors added after Shutdown are dropped
+	ec.Add(errorx.NewFromString("after shutdown"))
+	if ec.Dropped() != 1 || ec.SafeLength() != 0 {
+		fmt.Println(ec.Dropped(), ec.SafeLength())
+		t.Fail()
+		return
+	}
+	ec.CloseHandles()
+	ec.CloseHandles()
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ec := NewCollection(CollectionOption{QueueSize: 100})
+	ec.Handle(func(e error) {
+		time.Sleep(100 * time.Millisecond)
+	})
+	for i := 0; i < 10; i++ {
+		ec.Add(errorx.NewFromString(strconv.Itoa(i) + ":error"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	dropped, e := ec.Shutdown(ctx)
+	if e != context.DeadlineExceeded || dropped < 7 || dropped > 9 {
+		fmt.Println(dropped, e)
+		t.Fail()
+		return
+	}
+}
+
+func TestLoggerStack(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	Logger()(errorx.Wrap(errorx.NewFromString("an error happens")))
+	// the stack is logged, not only the message
+	if strings.Count(buf.String(), "errorCollection_test.go") < 2 {
+		fmt.Println(buf.String())
+		t.Fail()
+		return
+	}
+}
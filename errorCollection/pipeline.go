@@ -0,0 +1,244 @@
+package errorCollection
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// ErrStop is returned by a HandlerFunc to stop handlers after it, for the current error only.
+var ErrStop = errors.New("errorCollection: stop pipeline")
+
+// HandlerFunc handles an error in a Pipeline, ctx is done when the timeout of its stage runs out.
+type HandlerFunc func(ctx context.Context, e error) error
+
+// Middleware decorates a HandlerFunc, like Retry, FilterCode and Async.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain decorates h by mws, the first one is the outermost.
+func Chain(h HandlerFunc, mws ...Middleware) HandlerFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+type stage struct {
+	name    string
+	timeout time.Duration
+	h       HandlerFunc
+}
+
+// Pipeline runs handlers one by one for each error.
+// Each handler has its own timeout, a panic in it is recovered as its error, and it can stop the rest by ErrStop.
+// Errors of handlers don't stop the rest.
+//
+//	p := errorCollection.NewPipeline().
+//	    Use("log", 0, logError).
+//	    Use("ignore", 0, func(ctx context.Context, e error) error {
+//	        if strings.Contains(e.Error(), "ignorable") {
+//	            return errorCollection.ErrStop
+//	        }
+//	        return nil
+//	    }).
+//	    Use("email", 3*time.Second, errorCollection.Chain(sendEmail,
+//	        errorCollection.FilterCode(10001, 10002),
+//	        errorCollection.Retry(3, time.Second),
+//	    ))
+//	ec.HandlePipeline(p)
+type Pipeline struct {
+	l       sync.RWMutex
+	stages  []stage
+	metrics *errorx.Metrics
+}
+
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// SetMetrics makes p record metrics of handlers into m rather than errorx.DefaultMetrics.
+func (p *Pipeline) SetMetrics(m *errorx.Metrics) *Pipeline {
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.metrics = m
+	return p
+}
+
+// Use appends a handler named name, timeout <= 0 means no timeout.
+// When the timeout runs out, the pipeline goes on without waiting for the handler.
+func (p *Pipeline) Use(name string, timeout time.Duration, h HandlerFunc) *Pipeline {
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.stages = append(p.stages, stage{name: name, timeout: timeout, h: h})
+	return p
+}
+
+// Handle runs handlers for e, and returns their errors as an *errorx.MultiError, nil if none fails.
+func (p *Pipeline) Handle(ctx context.Context, e error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p.l.RLock()
+	stages := p.stages
+	m := p.metrics
+	p.l.RUnlock()
+	if m == nil {
+		m = errorx.DefaultMetrics
+	}
+
+	var (
+		me   errorx.MultiError
+		code = errorx.ErrorCode(e)
+	)
+	for _, s := range stages {
+		start := time.Now()
+		er := s.run(context.WithValue(ctx, stageKey{}, stageInfo{name: s.name, metrics: m}), e)
+		m.Observe("collection_handle_seconds", errorx.MetricLabels{Handler: s.name}, time.Since(start))
+		if errors.Is(er, ErrStop) {
+			m.Add("collection_handled", errorx.MetricLabels{Handler: s.name, Code: code}, 1)
+			break
+		}
+		if er != nil {
+			m.Add("collection_handler_failed", errorx.MetricLabels{Handler: s.name, Code: code}, 1)
+			me.Append(errorx.NewFromStringf("handler '%s': %s", s.name, er.Error()))
+			continue
+		}
+		m.Add("collection_handled", errorx.MetricLabels{Handler: s.name, Code: code}, 1)
+	}
+	return me.ErrorOrNil()
+}
+
+type stageKey struct{}
+
+// stageInfo tells middlewares which handler they're in, for metrics.
+type stageInfo struct {
+	name    string
+	metrics *errorx.Metrics
+}
+
+func (s stage) run(ctx context.Context, e error) (err error) {
+	if s.timeout <= 0 {
+		defer errorx.Recover(&err)
+		return s.h(ctx, e)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		var er error
+		defer func() {
+			done <- er
+		}()
+		defer errorx.Recover(&er)
+		er = s.h(ctx, e)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HandlePipeline handles errors by p, like Handle. Errors of handlers are logged.
+// p records metrics where ec does, unless it has its own, see SetMetrics. Metrics are labelled by its handlers,
+// the pipeline itself is not counted as a handler.
+func (ec *ErrorCollection) HandlePipeline(p *Pipeline) {
+	p.l.Lock()
+	if p.metrics == nil {
+		p.metrics = ec.opt.Metrics
+	}
+	p.l.Unlock()
+
+	ec.consume(consumer{name: "pipeline", staged: true, f: func(e error) {
+		if er := p.Handle(context.Background(), e); er != nil {
+			log.Println(er.Error())
+		}
+	}})
+}
+
+// Retry calls next again when it fails, at most attempts times in all, waiting backoff before the first retry and doubling it after.
+// ErrStop and ctx done are not retried. In a Pipeline, retries are counted as metric collection_retried.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, e error) error {
+			var (
+				er   error
+				wait = backoff
+			)
+			info, _ := ctx.Value(stageKey{}).(stageInfo)
+			for i := 0; i < attempts || i == 0; i++ {
+				if i > 0 {
+					select {
+					case <-ctx.Done():
+						return er
+					case <-time.After(wait):
+					}
+					wait *= 2
+					info.metrics.Add("collection_retried", errorx.MetricLabels{Handler: info.name, Code: errorx.ErrorCode(e)}, 1)
+				}
+				if er = next(ctx, e); er == nil || errors.Is(er, ErrStop) {
+					return er
+				}
+			}
+			return er
+		}
+	}
+}
+
+// FilterCode calls next only for service errors with errcode in codes, see errorx.IsServiceErr.
+// Other errors skip next, and go on to handlers after it.
+func FilterCode(codes ...int) Middleware {
+	var set = make(map[int]bool, len(codes))
+	for _, v := range codes {
+		set[v] = true
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, e error) error {
+			if se, ok := errorx.IsServiceErr(e); ok && set[se.Errcode] {
+				return next(ctx, e)
+			}
+			return nil
+		}
+	}
+}
+
+// Async calls next in a new goroutine and returns at once, so slow handlers like sending emails don't hold later ones.
+// At most limit goroutines run at the same time, more wait for one to finish, limit <= 0 means no limit.
+// next runs with ctx values but without its deadline, errors and panics of it are logged.
+func Async(limit int) Middleware {
+	var sem chan struct{}
+	if limit > 0 {
+		sem = make(chan struct{}, limit)
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, e error) error {
+			if sem != nil {
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			go func() {
+				var er error
+				defer func() {
+					if sem != nil {
+						<-sem
+					}
+					if er != nil && !errors.Is(er, ErrStop) {
+						log.Println(er.Error())
+					}
+				}()
+				defer errorx.Recover(&er)
+				er = next(context.WithoutCancel(ctx), e)
+			}()
+			return nil
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package errorCollection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+func TestPipeline(t *testing.T) {
+	var (
+		l     sync.Mutex
+		calls []string
+	)
+	record := func(name string) HandlerFunc {
+		return func(ctx context.Context, e error) error {
+			l.Lock()
+			defer l.Unlock()
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	p := NewPipeline().
+		Use("first", 0, record("first")).
+		Use("panic", 0, func(ctx context.Context, e error) error {
+			panic("handler panic")
+		}).
+		Use("slow", 50*time.Millisecond, func(ctx context.Context, e error) error {
+			time.Sleep(time.Second)
+			return nil
+		}).
+		Use("stop", 0, func(ctx context.Context, e error) error {
+			if strings.Contains(e.Error(), "ignorable") {
+				return ErrStop
+			}
+			return nil
+		}).
+		Use("last", 0, record("last"))
+
+	start := time.Now()
+	er := p.Handle(context.Background(), errorx.NewFromString("an error happens"))
+	if time.Since(start) > 500*time.Millisecond {
+		fmt.Println(time.Since(start))
+		t.Fail()
+		return
+	}
+	me, ok := er.(*errorx.MultiError)
+	if !ok || me.Len() != 2 || !strings.Contains(me.Error(), "handler 'panic'") || !strings.Contains(me.Error(), "handler 'slow': context deadline exceeded") {
+		fmt.Println(er)
+		t.Fail()
+		return
+	}
+
+	// ErrStop stops the rest for the current error only
+	if er := p.Handle(context.Background(), errorx.NewFromString("an ignorable error happens")); er == nil {
+		t.Fail()
+		return
+	}
+	p.Handle(context.Background(), errorx.NewFromString("another error happens"))
+
+	l.Lock()
+	defer l.Unlock()
+	if strings.Join(calls, ",") != "first,last,first,first,last" {
+		fmt.Println(calls)
+		t.Fail()
+		return
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls int32
+	flaky := func(ctx context.Context, e error) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("send email fail")
+		}
+		return nil
+	}
+
+	h := Chain(flaky, FilterCode(10001), Retry(3, time.Millisecond))
+	if er := h(context.Background(), errorx.NewFromString("not a service error")); er != nil || atomic.LoadInt32(&calls) != 0 {
+		fmt.Println(er, calls)
+		t.Fail()
+		return
+	}
+	if er := h(context.Background(), errorx.NewServiceError("balance not enough", 10001)); er != nil || atomic.LoadInt32(&calls) != 3 {
+		fmt.Println(er, calls)
+		t.Fail()
+		return
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	if er := Retry(2, time.Millisecond)(flaky)(context.Background(), errorx.NewFromString("nil return")); er == nil || atomic.LoadInt32(&calls) != 2 {
+		fmt.Println(er, calls)
+		t.Fail()
+		return
+	}
+
+	done := make(chan struct{})
+	async := Async(1)(func(ctx context.Context, e error) error {
+		time.Sleep(50 * time.Millisecond)
+		close(done)
+		return nil
+	})
+	start := time.Now()
+	if er := async(context.Background(), errorx.NewFromString("nil return")); er != nil || time.Since(start) > 25*time.Millisecond {
+		t.Fail()
+		return
+	}
+	<-done
+}
+
+func TestHandlePipeline(t *testing.T) {
+	ec := NewCollection()
+	handled := make(chan error, 1)
+	ec.HandlePipeline(NewPipeline().Use("notify", time.Second, func(ctx context.Context, e error) error {
+		handled <- e
+		return nil
+	}))
+	ec.Add(errorx.NewFromString("an error happens"))
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("time out")
+	}
+	ec.Shutdown(context.Background())
+}
+
+func TestCollectionMetrics(t *testing.T) {
+	m := errorx.NewMetrics()
+	ec := NewCollection(CollectionOption{QueueSize: 2, Policy: PolicyDropNewest, Metrics: m})
+	for i := 0; i < 3; i++ {
+		ec.Add(errorx.NewServiceError("balance not enough", 10001))
+	}
+
+	var calls int32
+	ec.HandlePipeline(NewPipeline().
+		Use("email", 0, Chain(func(ctx context.Context, e error) error {
+			if atomic.AddInt32(&calls, 1)%2 == 1 {
+				return errors.New("send email fail")
+			}
+			return nil
+		}, Retry(2, time.Millisecond))).
+		Use("panic", 0, func(ctx context.Context, e error) error {
+			panic("handler panic")
+		}))
+	ec.Shutdown(context.Background())
+
+	code := errorx.MetricLabels{Code: 10001}
+	if m.Counter("collection_queued", code) != 2 || m.Counter("collection_dropped", code) != 1 ||
+		m.Counter("collection_handled", errorx.MetricLabels{Handler: "email", Code: 10001}) != 2 ||
+		m.Counter("collection_retried", errorx.MetricLabels{Handler: "email", Code: 10001}) != 2 ||
+		m.Counter("collection_handler_failed", errorx.MetricLabels{Handler: "panic", Code: 10001}) != 2 ||
+		m.Counter("collection_handled", errorx.MetricLabels{Handler: "pipeline", Code: 10001}) != 0 {
+		fmt.Println(m.String())
+		t.Fail()
+		return
+	}
+	// a pipeline isn't counted besides its handlers, so summing over handlers is right
+	for _, v := range m.Snapshot().Histograms {
+		if v.Labels.Handler == "pipeline" {
+			fmt.Println(m.String())
+			t.Fail()
+			return
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package errorCollection
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// SpoolOption configures a Spool.
+type SpoolOption struct {
+	// a new segment is started when the current one reaches SegmentSize bytes, default 16MB
+	SegmentSize int64
+	// fsync after every record, so errors survive a crash of the machine rather than of the process only
+	Sync bool
+}
+
+const (
+	recordError byte = 1
+	recordAck   byte = 2
+
+	// length(4) crc32(4)
+	recordPrefixSize = 8
+	// type(1) seq(8)
+	recordMetaSize = 9
+	segmentExt     = ".seg"
+)
+
+// Spool is a write-ahead log of errors queued in an ErrorCollection, see CollectionOption.Spool.
+// Errors are appended to segment files as errorx json, keeping their stacks and headers, and acknowledged once handled.
+// Errors not acknowledged are replayed by the next collection opened with the spool.
+// Segments are removed once all errors in them, and in segments before them, are acknowledged.
+//
+// A record in segments is:
+//
+//	length  uint32, of type, seq and payload
+//	crc32   uint32, IEEE of type, seq and payload
+//	type    byte, 1 error, 2 ack
+//	seq     uint64, of the error, or of the error acknowledged
+//	payload errorx json of the error, empty for ack
+type Spool struct {
+	dir string
+	opt SpoolOption
+
+	l        sync.Mutex
+	f        *os.File
+	w        *bufio.Writer
+	size     int64
+	nextSeq  uint64
+	segments []*segment
+	// errors not acknowledged when opened, taken by the collection
+	replay []spooled
+	closed bool
+}
+
+type segment struct {
+	first   uint64
+	path    string
+	pending int
+}
+
+type spooled struct {
+	seq uint64
+	e   error
+}
+
+// OpenSpool opens the spool in dir, creates it if not exists, and loads errors not acknowledged.
+// A torn record at the end of a segment, left by a crash, is truncated.
+func OpenSpool(dir string, opt SpoolOption) (*Spool, error) {
+	if opt.SegmentSize <= 0 {
+		opt.SegmentSize = 16 << 20
+	}
+	if er := os.MkdirAll(dir, 0755); er != nil {
+		return nil, errorx.Wrap(er)
+	}
+	s := &Spool{dir: dir, opt: opt, nextSeq: 1}
+	if er := s.load(); er != nil {
+		return nil, er
+	}
+	if er := s.openSegment(); er != nil {
+		return nil, er
+	}
+	// the last segment loaded is not the current one any more
+	if er := s.compact(); er != nil {
+		return nil, er
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	infos, er := os.ReadDir(s.dir)
+	if er != nil {
+		return errorx.Wrap(er)
+	}
+	for _, v := range infos {
+		name := v.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, er := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if er != nil {
+			continue
+		}
+		s.segments = append(s.segments, &segment{first: first, path: filepath.Join(s.dir, name)})
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].first < s.segments[j].first
+	})
+
+	var (
+		errs  = make(map[uint64][]byte, 0)
+		owner = make(map[uint64]*segment, 0)
+	)
+	for _, seg := range s.segments {
+		er := readSegment(seg.path, func(typ byte, seq uint64, payload []byte) {
+			if seq >= s.nextSeq {
+				s.nextSeq = seq + 1
+			}
+			switch typ {
+			case recordError:
+				errs[seq] = payload
+				owner[seq] = seg
+				seg.pending++
+			case recordAck:
+				if _, ok := errs[seq]; ok {
+					delete(errs, seq)
+					owner[seq].pending--
+					delete(owner, seq)
+				}
+			}
+		})
+		if er != nil {
+			return er
+		}
+	}
+
+	var seqs = make([]uint64, 0, len(errs))
+	for seq := range errs {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+	for _, seq := range seqs {
+		var e errorx.Error
+		if er := json.Unmarshal(errs[seq], &e); er != nil {
+			log.Printf("errorx: spool '%s' drops error %d, err=%s\n", s.dir, seq, er.Error())
+			owner[seq].pending--
+			continue
+		}
+		s.replay = append(s.replay, spooled{seq: seq, e: e})
+	}
+	return nil
+}
+
+// readSegment calls f with every valid record, and truncates the segment at the first invalid one.
+func readSegment(path string, f func(typ byte, seq uint64, payload []byte)) error {
+	file, er := os.OpenFile(path, os.O_RDWR, 0644)
+	if er != nil {
+		return errorx.Wrap(er)
+	}
+	defer file.Close()
+
+	var (
+		r      = bufio.NewReader(file)
+		offset int64
+		header = make([]byte, recordPrefixSize)
+	)
+	for {
+		if _, er := io.ReadFull(r, header); er != nil {
+			if er == io.EOF {
+				return nil
+			}
+			break
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		sum := binary.BigEndian.Uint32(header[4:8])
+		if length < recordMetaSize {
+			break
+		}
+		body := make([]byte, length)
+		if _, er := io.ReadFull(r, body); er != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(body) != sum {
+			break
+		}
+		f(body[0], binary.BigEndian.Uint64(body[1:recordMetaSize]), body[recordMetaSize:])
+		offset += int64(recordPrefixSize + length)
+	}
+
+	log.Printf("errorx: spool segment '%s' is torn at %d, truncated\n", path, offset)
+	return errorx.Wrap(file.Truncate(offset))
+}
+
+// openSegment starts a new segment from nextSeq, s.l is held or s is not shared yet.
+// A segment is never reopened, when the current one holds acks only, seqs are skipped to start after it.
+func (s *Spool) openSegment() error {
+	if n := len(s.segments); n != 0 && s.nextSeq <= s.segments[n-1].first {
+		s.nextSeq = s.segments[n-1].first + 1
+	}
+	seg := &segment{first: s.nextSeq, path: filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.nextSeq, segmentExt))}
+	f, er := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if er != nil {
+		return errorx.Wrap(er)
+	}
+	info, er := f.Stat()
+	if er != nil {
+		f.Close()
+		return errorx.Wrap(er)
+	}
+	s.segments = append(s.segments, seg)
+	s.f = f
+	s.w = bufio.NewWriter(f)
+	s.size = info.Size()
+	return nil
+}
+
+func (s *Spool) write(typ byte, seq uint64, payload []byte) error {
+	if s.f == nil {
+		return fmt.Errorf("errorx: spool '%s' closed", s.dir)
+	}
+	if s.size >= s.opt.SegmentSize {
+		if er := s.closeSegment(); er != nil {
+			return er
+		}
+		if er := s.openSegment(); er != nil {
+			return er
+		}
+	}
+
+	buf := make([]byte, recordPrefixSize+recordMetaSize+len(payload))
+	body := buf[recordPrefixSize:]
+	body[0] = typ
+	binary.BigEndian.PutUint64(body[1:recordMetaSize], seq)
+	copy(body[recordMetaSize:], payload)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(body))
+
+	if _, er := s.w.Write(buf); er != nil {
+		return errorx.Wrap(er)
+	}
+	s.size += int64(len(buf))
+	// a record is flushed at once, so it survives the process
+	if er := s.w.Flush(); er != nil {
+		return errorx.Wrap(er)
+	}
+	if s.opt.Sync {
+		return errorx.Wrap(s.f.Sync())
+	}
+	return nil
+}
+
+// append writes e and returns its seq.
+func (s *Spool) append(e error) (uint64, error) {
+	// an official error is kept as the origin, without a stack line of the spool
+	x, ok := e.(errorx.Error)
+	if !ok {
+		x = errorx.Empty()
+		x.E = e
+	}
+	buf, er := json.Marshal(x)
+	if er != nil {
+		return 0, errorx.Wrap(er)
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	seq := s.nextSeq
+	if er := s.write(recordError, seq, buf); er != nil {
+		return 0, er
+	}
+	s.nextSeq++
+	s.segments[len(s.segments)-1].pending++
+	return seq, nil
+}
+
+// ack acknowledges the error of seq, and removes segments acknowledged.
+// After Close it does nothing, like handlers still running after Shutdown times out, the error is replayed next time.
+func (s *Spool) ack(seq uint64) error {
+	if seq == 0 {
+		return nil
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.closed {
+		return nil
+	}
+	if er := s.write(recordAck, seq, nil); er != nil {
+		return er
+	}
+	// the segment holding seq is the last one starting before it
+	i := sort.Search(len(s.segments), func(i int) bool {
+		return s.segments[i].first > seq
+	}) - 1
+	if i >= 0 {
+		s.segments[i].pending--
+	}
+	return s.compact()
+}
+
+// compact removes the oldest segments without pending errors, the current one is kept.
+// Acks in a segment refer to errors in it or before it, so removing from the oldest never loses an ack still needed.
+func (s *Spool) compact() error {
+	for len(s.segments) > 1 && s.segments[0].pending <= 0 {
+		if er := os.Remove(s.segments[0].path); er != nil && !os.IsNotExist(er) {
+			return errorx.Wrap(er)
+		}
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// takeReplay returns errors not acknowledged when opened, once.
+func (s *Spool) takeReplay() []spooled {
+	s.l.Lock()
+	defer s.l.Unlock()
+	rs := s.replay
+	s.replay = nil
+	return rs
+}
+
+// Segments returns the number of segment files.
+func (s *Spool) Segments() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return len(s.segments)
+}
+
+func (s *Spool) closeSegment() error {
+	er := s.w.Flush()
+	if e := s.f.Close(); er == nil {
+		er = e
+	}
+	s.f = nil
+	s.w = nil
+	return errorx.Wrap(er)
+}
+
+// Close closes the current segment, errors not acknowledged are replayed when the spool is opened again.
+func (s *Spool) Close() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.closed = true
+	if s.f == nil {
+		return nil
+	}
+	return s.closeSegment()
+}
@@ -0,0 +1,237 @@
+package errorCollection
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+func TestSpool(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx-spool")
+	defer os.RemoveAll(dir)
+
+	sp, er := OpenSpool(dir, SpoolOption{SegmentSize: 4096})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	ec := NewCollection(CollectionOption{Spool: sp})
+	for i := 0; i < 30; i++ {
+		e := errorx.NewFromString(strconv.Itoa(i) + ":error")
+		e = errorx.WrapContext(e, map[string]interface{}{"index": i})
+		ec.Add(e)
+	}
+	// 10 handled, the rest are left when the process dies
+	for i := 0; i < 10; i++ {
+		ec.Pop()
+	}
+	sp.Close()
+
+	// a torn record at the end, like a crash in writing
+	segs, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	f, _ := os.OpenFile(segs[len(segs)-1], os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	f.Close()
+
+	sp, er = OpenSpool(dir, SpoolOption{SegmentSize: 4096})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	ec = NewCollection(CollectionOption{Spool: sp})
+	if ec.SafeLength() != 20 {
+		fmt.Println(ec.SafeLength())
+		t.Fail()
+		return
+	}
+
+	var handled []error
+	ec.Handle(func(e error) {
+		handled = append(handled, e)
+	})
+	if dropped, e := ec.Shutdown(context.Background()); dropped != 0 || e != nil {
+		fmt.Println(dropped, e)
+		t.Fail()
+		return
+	}
+	if len(handled) != 20 {
+		fmt.Println(len(handled))
+		t.Fail()
+		return
+	}
+	// errors keep their stacks and attrs
+	first, ok := handled[0].(errorx.Error)
+	index, _ := first.Attr("index")
+	if !ok || index.Value != int64(10) || !strings.Contains(first.Error(), "spool_test.go") {
+		fmt.Println(first.Error())
+		t.Fail()
+		return
+	}
+
+	// all acknowledged, segments but the current one are compacted
+	if sp.Segments() != 1 {
+		fmt.Println(sp.Segments())
+		t.Fail()
+		return
+	}
+	sp.Close()
+
+	sp, _ = OpenSpool(dir, SpoolOption{})
+	defer sp.Close()
+	if ec := NewCollection(CollectionOption{Spool: sp}); ec.SafeLength() != 0 {
+		fmt.Println(ec.SafeLength())
+		t.Fail()
+		return
+	}
+}
+
+// errors left by a Shutdown timing out are kept in spool
+func TestSpoolShutdown(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx-spool")
+	defer os.RemoveAll(dir)
+
+	sp, _ := OpenSpool(dir, SpoolOption{})
+	ec := NewCollection(CollectionOption{Spool: sp})
+	for i := 0; i < 5; i++ {
+		ec.Add(errorx.NewFromString(strconv.Itoa(i) + ":error"))
+	}
+	ec.Handle(func(e error) {
+		time.Sleep(100 * time.Millisecond)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if dropped, e := ec.Shutdown(ctx); dropped != 0 || e == nil {
+		fmt.Println(dropped, e)
+		t.Fail()
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+	sp.Close()
+
+	sp, _ = OpenSpool(dir, SpoolOption{})
+	defer sp.Close()
+	if ec := NewCollection(CollectionOption{Spool: sp}); ec.SafeLength() != 4 {
+		fmt.Println(ec.SafeLength())
+		t.Fail()
+		return
+	}
+}
+
+// handlers still running after Shutdown times out don't write into the spool closed, their errors are replayed
+func TestSpoolShutdownClose(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx-spool")
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	sp, _ := OpenSpool(dir, SpoolOption{})
+	ec := NewCollection(CollectionOption{Spool: sp})
+	for i := 0; i < 5; i++ {
+		ec.Add(errorx.NewFromString(strconv.Itoa(i) + ":error"))
+	}
+	handled := make(chan struct{})
+	ec.Handle(func(e error) {
+		time.Sleep(100 * time.Millisecond)
+		close(handled)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ec.Shutdown(ctx)
+	sp.Close()
+	<-handled
+	time.Sleep(10 * time.Millisecond)
+
+	if strings.Contains(buf.String(), "ack spooled error") {
+		fmt.Println(buf.String())
+		t.Fail()
+		return
+	}
+	sp, _ = OpenSpool(dir, SpoolOption{})
+	defer sp.Close()
+	if ec := NewCollection(CollectionOption{Spool: sp}); ec.SafeLength() != 5 {
+		fmt.Println(ec.SafeLength())
+		t.Fail()
+		return
+	}
+}
+
+// segments holding acks only are rotated into new ones as well, and compacted
+func TestSpoolRotateAcks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx-spool")
+	defer os.RemoveAll(dir)
+
+	const segmentSize = 64
+	sp, _ := OpenSpool(dir, SpoolOption{SegmentSize: segmentSize})
+	defer sp.Close()
+
+	var seqs []uint64
+	for i := 0; i < 20; i++ {
+		seq, er := sp.append(fmt.Errorf("%d:error", i))
+		if er != nil {
+			fmt.Println(er.Error())
+			t.Fail()
+			return
+		}
+		seqs = append(seqs, seq)
+	}
+	for _, seq := range seqs {
+		if er := sp.ack(seq); er != nil {
+			fmt.Println(er.Error())
+			t.Fail()
+			return
+		}
+	}
+
+	segs, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	for _, v := range segs {
+		// an ack record is 17 bytes
+		if info, _ := os.Stat(v); info.Size() >= segmentSize+17 {
+			fmt.Println(v, info.Size())
+			t.Fail()
+		}
+	}
+	if sp.Segments() > 2 || len(segs) != sp.Segments() {
+		fmt.Println(sp.Segments(), segs)
+		t.Fail()
+		return
+	}
+}
+
+// official errors are spooled without a stack line added by the spool
+func TestSpoolAppendOfficial(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx-spool")
+	defer os.RemoveAll(dir)
+
+	sp, _ := OpenSpool(dir, SpoolOption{})
+	sp.append(fmt.Errorf("nil return"))
+	sp.Close()
+
+	sp, _ = OpenSpool(dir, SpoolOption{})
+	defer sp.Close()
+	replay := sp.takeReplay()
+	if len(replay) != 1 {
+		fmt.Println(len(replay))
+		t.Fail()
+		return
+	}
+	e := replay[0].e.(errorx.Error)
+	if e.Message() != "nil return" || len(e.Stack()) != 0 {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,8 +15,26 @@ const (
 	LcauseBy = 1 << iota
 	LdateTime
 	Llongfile
+	// Lfullstack makes an error record the whole call stack as program counters when it's created.
+	// Program counters are resolved into functions, files and lines only when Stack() or Error() is called.
+	Lfullstack
 )
 
+var defaultFlag int32 = Llongfile | LcauseBy | LdateTime
+
+// SetFlags sets flags for errors created after it, like log.SetFlags.
+// To keep the default stack line and capture the whole call stack as well:
+//
+//	errorx.SetFlags(errorx.Flags() | errorx.Lfullstack)
+func SetFlags(flag int) {
+	atomic.StoreInt32(&defaultFlag, int32(flag))
+}
+
+// Flags returns flags for errors created from now on.
+func Flags() int {
+	return int(atomic.LoadInt32(&defaultFlag))
+}
+
 // an Error instance wraps an official error and storage its stackTrace.
 // When tries to wrap the origin error to another, logic does like:
 //
@@ -37,6 +56,8 @@ type Error struct {
 	E             error
 	StackTraces   []string    // Deprecated,保留了字段防止外部应用直接使用引起无法编译问题
 	stackTracesV2 []stackline // 新版堆栈路径
+	pcs           []uintptr   // whole call stack captured when Lfullstack is set
+	frames        []Frame     // resolved call stack decoded from json, used when pcs is empty
 
 	isServiceErr   bool
 	serviceErrcode int
@@ -55,15 +76,16 @@ type Error struct {
 
 func (e *Error) wrapStackLine(desc string) {
 
-	trace := stackDepth3()
+	line := stackDepth3(e.Flag)
+	line.desc = desc
+	if e.Flag&Lfullstack > 0 && len(e.pcs) == 0 {
+		e.pcs = callers(4)
+	}
 	if len(e.stackTracesV2) == 0 {
 		e.stackTracesV2 = make([]stackline, 0, 10)
 	}
 
-	e.stackTracesV2 = append([]stackline{{
-		trace: trace,
-		desc:  desc,
-	}}, e.stackTracesV2...)
+	e.stackTracesV2 = append([]stackline{line}, e.stackTracesV2...)
 }
 
 func (e *Error) wrapStackLineWithTrace(trace string, desc string) {
@@ -81,8 +103,10 @@ func (e Error) Stack() []string {
 	var rs = make([]string, 0, 10)
 
 	for _, v := range e.stackTracesV2 {
-		tmp := fmt.Sprintf("%s %s", v.trace, v.desc)
-		rs = append(rs, tmp)
+		rs = append(rs, v.String())
+	}
+	for _, v := range e.StackFrames() {
+		rs = append(rs, v.String())
 	}
 
 	return rs
@@ -131,7 +155,7 @@ func empty() Error {
 		Context:       make(map[string]interface{}, 0),
 		ReGenerated:   false,
 		Errors:        make([]error, 0, 30),
-		Flag:          Llongfile | LcauseBy | LdateTime,
+		Flag:          Flags(),
 	}
 }
 
@@ -143,6 +167,15 @@ func (e Error) Error() string {
 	}
 	rs := fmt.Sprintf("%s%s\n", header, e.StackTraceValue())
 
+	if frames := e.StackFrames(); len(frames) != 0 {
+		rs += fmt.Sprintf("stack:\n%s", formatFrames(frames))
+	}
+
+	// attrs of WrapContext are in the stack already
+	if attrs := collectAttrs(e, false); len(attrs) != 0 {
+		rs += fmt.Sprintf("attrs:\n%s", formatAttrs(attrs))
+	}
+
 	if len(e.Context) != 0 {
 		buf, _ := json.MarshalIndent(e.Context, "  ", "  ")
 		rs += fmt.Sprintf("context:\n%s\n", buf)
@@ -156,6 +189,39 @@ func (e Error) BasicError() string {
 	return ""
 }
 
+// Unwrap returns the origin error, so errors.Is, errors.As and errors.Unwrap can walk through an Error.
+func (e Error) Unwrap() error {
+	return e.E
+}
+
+// Is reports whether any error saved in 'Errors' matches target.
+// 'E' is not checked here, errors.Is reaches it through Unwrap.
+func (e Error) Is(target error) bool {
+	for _, v := range e.Errors {
+		if v == nil {
+			continue
+		}
+		if errors.Is(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error saved in 'Errors' that matches target.
+// 'E' is not checked here, errors.As reaches it through Unwrap.
+func (e Error) As(target interface{}) bool {
+	for _, v := range e.Errors {
+		if v == nil {
+			continue
+		}
+		if errors.As(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // return its stacktrace
 func (e Error) StackTrace() string {
 	return e.StackTraceValue()
@@ -185,6 +251,20 @@ func NewWithAttach(e error, msg interface{}) error {
 	return er
 }
 
+// NewWithStack news an error recording the whole call stack, whatever Lfullstack is set or not.
+// It suits errors which are created once and never wrapped again.
+func NewWithStack(e error) error {
+	if e == nil {
+		return nil
+	}
+
+	tmp := empty()
+	tmp.Flag |= Lfullstack
+	tmp.E = e
+	tmp.wrapStackLine(e.Error())
+	return tmp
+}
+
 // New a error
 func New(e error) error {
 	if e == nil {
@@ -209,8 +289,7 @@ func (e Error) StackTraceValue() string {
 	rs := make([]string, 0, 10)
 
 	for _, v := range e.stackTracesV2 {
-		tmp := fmt.Sprintf("%s %s", v.trace, v.desc)
-		rs = append(rs, tmp)
+		rs = append(rs, v.String())
 	}
 
 	return strings.Join(rs, " | ")
@@ -223,29 +302,31 @@ func Wrap(e error) error {
 	if e == nil {
 		return nil
 	}
+	errorX, desc := wrapped(e)
+	errorX.wrapStackLine(desc)
+	return errorX
+}
+
+// wrapped makes the Error that Wrap and its variants return for e, before they add the stack line of desc.
+// The stack line is left to callers, because it's recorded at a fixed depth.
+func wrapped(e error) (Error, string) {
 	switch v := e.(type) {
 	case Error:
-		v.wrapStackLine("")
 		v.index++
-		return v
+		return v, ""
 	case ServiceError:
 		errorX := Empty()
 		errorX.E = e
 		errorX.isServiceErr = true
 		errorX.serviceErrcode = v.Errcode
 		errorX.serviceErrmsg = v.Errmsg
-
-		errorX.wrapStackLine(v.Errmsg)
-		return errorX
-	case error:
+		return errorX, v.Errmsg
+	default:
 		errorX := empty()
 		errorX.E = e
 		errorX.Errors = append(errorX.Errors, e)
-
-		errorX.wrapStackLine(e.Error())
-		return errorX
+		return errorX, e.Error()
 	}
-	return Wrap(errors.New("invalid error type,error type should be official or errorx.Error"))
 }
 
 func NewFromStringWithDepth(msg string, depth int) error {
@@ -363,9 +444,11 @@ func NewWithParam(e error, params ...interface{}) error {
 		return tmp
 	}
 
+	rd := currentRedactor()
 	var infoarr = make([]string, 0, 10)
 	for i, v := range params {
-		pair := fmt.Sprintf("param%d=%v", i, v)
+		key := fmt.Sprintf("param%d", i)
+		pair := fmt.Sprintf("%s=%v", key, rd.Redact(key, v))
 		infoarr = append(infoarr, pair)
 	}
 
@@ -387,9 +470,11 @@ func NewFromStringWithParam(msg string, params ...interface{}) error {
 		return tmp
 	}
 
+	rd := currentRedactor()
 	var infoarr = make([]string, 0, 10)
 	for i, v := range params {
-		pair := fmt.Sprintf("param%d=%v", i, v)
+		key := fmt.Sprintf("param%d", i)
+		pair := fmt.Sprintf("%s=%v", key, rd.Redact(key, v))
 		infoarr = append(infoarr, pair)
 	}
 
@@ -403,6 +488,9 @@ func NewFromStringWithParam(msg string, params ...interface{}) error {
 }
 
 // group series of error to a single error
+// Members are saved in 'Errors', so errors.Is and errors.As can match them.
+//
+// Deprecated: use MultiError, which keeps each member's own stack.
 func GroupErrors(es ...error) error {
 
 	tmp := empty()
@@ -416,6 +504,7 @@ func GroupErrors(es ...error) error {
 		pair := fmt.Sprintf("error_%d=%s", i, v.Error())
 
 		infoarr = append(infoarr, pair)
+		tmp.Errors = append(tmp.Errors, v)
 	}
 
 	tmp.wrapStackLine(fmt.Sprintf("Group Errors %s", strings.Join(infoarr, " ")))
@@ -434,21 +523,37 @@ func NewFromStackTrace(stackTrace []string, msg string) error {
 	return e
 }
 
+// NewFromRemoteStackTrace acts like NewFromStackTrace, but marks each trace as coming from the remote service.
+func NewFromRemoteStackTrace(service string, stackTrace []string, msg string) error {
+	e := empty()
+
+	for _, v := range stackTrace {
+		e.wrapStackLineWithTrace(v, msg)
+		e.stackTracesV2[0].remote = service
+	}
+
+	return e
+}
+
+// WrapContext wraps e with ctx formatted into the description of the new layer.
+// Values of ctx are kept as attrs of the layer as well, see Attrs.
+// Sensitive values are redacted by the package-level redactor, see SetRedactor.
 func WrapContext(e error, ctx map[string]interface{}) error {
 	if e == nil {
 		return nil
 	}
 
-	var infoparams = make([]string, 0, 10)
-	for k, v := range ctx {
-		argone := fmt.Sprintf("%s=%v", k, v)
-		infoparams = append(infoparams, argone)
-	}
-	ctxinfo := strings.Join(infoparams, " ")
+	ctx = currentRedactor().RedactMap(ctx)
+
+	// the description is rendered from attrs, so redactors can find values of keys in it, see Redactor.RedactError
+	attrs := sortedAttrs(ctx)
+	ctxinfo := formatPairs(attrs)
 
 	switch v := e.(type) {
 	case Error:
 		v.wrapStackLine(ctxinfo)
+		v.stackTracesV2[0].attrs = attrs
+		v.stackTracesV2[0].described = true
 		v.index++
 		return v
 	case ServiceError:
@@ -459,12 +564,16 @@ func WrapContext(e error, ctx map[string]interface{}) error {
 		errorX.serviceErrmsg = v.Errmsg
 
 		errorX.wrapStackLine(fmt.Sprintf("errno=%d errmsg=%s %s", v.Errcode, v.Errmsg, ctxinfo))
+		errorX.stackTracesV2[0].attrs = attrs
+		errorX.stackTracesV2[0].described = true
 		return errorX
 	case error:
 		errorX := empty()
 		errorX.E = e
 		errorX.Errors = append(errorX.Errors, e)
 		errorX.wrapStackLine(fmt.Sprintf("%s %s", e.Error(), ctxinfo))
+		errorX.stackTracesV2[0].attrs = attrs
+		errorX.stackTracesV2[0].described = true
 		return errorX
 	}
 	return Wrap(errors.New("invalid error type,error type should be official or errorx.Error"))
@@ -490,6 +599,9 @@ func MustWrap(e error) Error {
 // key word is used to help save errors in database
 // It's suggested to set unique(date, keyword), when error with same keyword in a day,database only saves field 'times'
 // rather than another error record
+//
+// Deprecated: the keyword contains the time of the error, so it changes every second and is not unique.
+// Use Fingerprint as the keyword instead.
 func (e Error) GenerateKeyword() string {
 	arr := e.stackTracesV2
 	if len(arr) == 0 {
@@ -500,6 +612,8 @@ func (e Error) GenerateKeyword() string {
 }
 
 // generate key word to an error type
+//
+// Deprecated: use Fingerprint.
 func GenerateKeyword(e error) string {
 	switch v := e.(type) {
 	case Error:
@@ -550,7 +664,11 @@ func Split2(s string, sub string, tmp *string, rs *[]string) {
 }
 
 func ToString(arg interface{}) string {
-	tmp := reflect.Indirect(reflect.ValueOf(arg)).Interface()
+	rv := reflect.ValueOf(arg)
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return ""
+	}
+	tmp := reflect.Indirect(rv).Interface()
 	switch v := tmp.(type) {
 	case int:
 		return strconv.Itoa(v)
@@ -570,6 +688,10 @@ func ToString(arg interface{}) string {
 		return strconv.FormatFloat(v, 'f', -1, 64)
 	case time.Time:
 		return v.Format("2006-01-02 15:04:05")
+	case bool:
+		return strconv.FormatBool(v)
+	case uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
 	case fmt.Stringer:
 		return v.String()
 	default:
@@ -584,6 +706,9 @@ func IsError(src error, dest error) (string, bool) {
 	if dest == nil {
 		return "", false
 	}
+	if errors.Is(src, dest) {
+		return dest.Error(), true
+	}
 
 	switch v := src.(type) {
 	case Error:
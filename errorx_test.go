@@ -331,3 +331,65 @@ func TestSe(t *testing.T) {
 	}
 	fmt.Println("系统错误",e.Error())
 }
+
+func TestUnwrap(t *testing.T) {
+	origin := fmt.Errorf("no rows in result set")
+	e := Wrap(WrapContext(Wrap(origin), map[string]interface{}{
+		"user_id": 1,
+	}))
+
+	if !errors.Is(e, origin) {
+		fmt.Println("errors.Is should find origin in chain")
+		t.Fail()
+		return
+	}
+	if errors.Unwrap(e) != origin {
+		fmt.Println("errors.Unwrap should return origin error")
+		t.Fail()
+		return
+	}
+
+	var x Error
+	if !errors.As(fmt.Errorf("query user: %w", e), &x) {
+		fmt.Println("errors.As should find errorx.Error in chain")
+		t.Fail()
+		return
+	}
+	if x.BasicError() != origin.Error() {
+		fmt.Println(x.BasicError())
+		t.Fail()
+		return
+	}
+
+	if _, ok := IsError(fmt.Errorf("query user: %w", e), origin); !ok {
+		fmt.Println("IsError should find origin in chain")
+		t.Fail()
+		return
+	}
+}
+
+func TestIsServiceErrChain(t *testing.T) {
+	se := NewServiceError("balance not enough", 10041)
+	e := fmt.Errorf("pay order: %w", Wrap(WrapContext(se, nil)))
+
+	got, ok := IsServiceErr(e)
+	if !ok || got.Errcode != 10041 {
+		fmt.Println(got, ok)
+		t.Fail()
+		return
+	}
+
+	got, ok = IsServiceErr(e, se)
+	if !ok || got.Errcode != 10041 {
+		fmt.Println(got, ok)
+		t.Fail()
+		return
+	}
+
+	// same message but different identity should not match
+	if _, ok := IsServiceErr(Wrap(fmt.Errorf("balance not enough")), se); ok {
+		fmt.Println("string equality should not be regarded as service error")
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,21 @@
+// Package expvarmetrics publishes errorx metrics as expvar variables.
+// It's a package of its own, since importing expvar serves /debug/vars on http.DefaultServeMux,
+// programs importing errorx only don't expose it unless they ask to.
+package expvarmetrics
+
+import (
+	"expvar"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+// Publish publishes m as expvar name, m nil means errorx.DefaultMetrics.
+// Like expvar.Publish, it panics if name is published already.
+//
+//	expvarmetrics.Publish("errorx", nil)
+func Publish(name string, m *errorx.Metrics) {
+	if m == nil {
+		m = errorx.DefaultMetrics
+	}
+	expvar.Publish(name, m)
+}
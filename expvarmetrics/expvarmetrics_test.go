@@ -0,0 +1,28 @@
+package expvarmetrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"testing"
+
+	"github.com/fwhezfwhez/errorx"
+)
+
+func TestPublish(t *testing.T) {
+	Publish("errorx", nil)
+	m := errorx.NewMetrics()
+	m.Add("reporter_saved", errorx.MetricLabels{Mode: "pro"}, 1)
+	Publish("errorx_pay", m)
+
+	if expvar.Get("errorx") != errorx.DefaultMetrics {
+		t.Fail()
+		return
+	}
+	var tmp errorx.MetricsSnapshot
+	if e := json.Unmarshal([]byte(expvar.Get("errorx_pay").String()), &tmp); e != nil || len(tmp.Counters) != 1 {
+		fmt.Println(expvar.Get("errorx_pay").String())
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,170 @@
+package errorx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NormalizeRule replaces what matches Pattern with Replace.
+type NormalizeRule struct {
+	Pattern *regexp.Regexp
+	Replace string
+}
+
+// DefaultMessageRules turn a message into its template, by replacing variable parts with placeholders.
+//
+//	user 'ft' not found, id=10086 -> user <str> not found, id=<num>
+var DefaultMessageRules = []NormalizeRule{
+	{Pattern: regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), Replace: "<uuid>"},
+	{Pattern: regexp.MustCompile(`0[xX][0-9a-fA-F]+`), Replace: "<hex>"},
+	{Pattern: regexp.MustCompile(`'[^']*'|"[^"]*"`), Replace: "<str>"},
+	{Pattern: regexp.MustCompile(`\d+(\.\d+)?`), Replace: "<num>"},
+}
+
+// Fingerprinter hashes an error into a stable key.
+// The hash is made of:
+//   - the root error type, and errcode for a service error
+//   - the root message normalized by MessageRules
+//   - function and file of each frame normalized by FileRules, without line numbers and time by default
+//
+// Frames come from the whole call stack when the error records it, see Lfullstack, otherwise from its stack lines.
+type Fingerprinter struct {
+	// hash line numbers of frames as well
+	KeepLine bool
+	// max frames hashed from the innermost, 0 means all
+	MaxFrames int
+	// applied to the root message in order
+	MessageRules []NormalizeRule
+	// applied to file paths in order, like trimming GOPATH to make fingerprints the same across machines
+	FileRules []NormalizeRule
+}
+
+// DefaultFingerprinter is used by Fingerprint.
+var DefaultFingerprinter = NewFingerprinter()
+
+func NewFingerprinter() *Fingerprinter {
+	return &Fingerprinter{
+		MessageRules: append([]NormalizeRule(nil), DefaultMessageRules...),
+	}
+}
+
+// Fingerprint returns a stable key of e by DefaultFingerprinter.
+// The same error from the same place always has the same fingerprint, so it suits the unique key of
+// (date, keyword) scheme, see GenerateKeyword.
+func Fingerprint(e error) string {
+	return DefaultFingerprinter.Fingerprint(e)
+}
+
+// Fingerprint returns a stable key of e by DefaultFingerprinter.
+func (e Error) Fingerprint() string {
+	return DefaultFingerprinter.Fingerprint(e)
+}
+
+// Fingerprint returns a stable key of e, a hex string of 32 characters.
+func (f *Fingerprinter) Fingerprint(e error) string {
+	if e == nil {
+		return ""
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", rootType(e), f.normalize(f.MessageRules, rootMessage(e)))
+
+	frames := f.frames(e)
+	if f.MaxFrames > 0 && len(frames) > f.MaxFrames {
+		frames = frames[:f.MaxFrames]
+	}
+	for _, v := range frames {
+		fmt.Fprintf(h, "%s\n", v)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// frames returns normalized frames of e from the innermost.
+func (f *Fingerprinter) frames(e error) []string {
+	var x Error
+	if !errors.As(e, &x) {
+		return nil
+	}
+
+	var rs = make([]string, 0, 10)
+	if frames := x.StackFrames(); len(frames) != 0 {
+		for _, v := range frames {
+			rs = append(rs, f.frame(v.Function, v.File, v.Line, ""))
+		}
+		return rs
+	}
+
+	for i := len(x.stackTracesV2) - 1; i >= 0; i-- {
+		v := x.stackTracesV2[i]
+		if v.file == "" && v.function() == "" {
+			// lines made by NewFromStackTrace only have a trace
+			rs = append(rs, f.frame("", traceFile(v.trace), 0, v.remote))
+			continue
+		}
+		rs = append(rs, f.frame(v.function(), v.file, v.line, v.remote))
+	}
+	return rs
+}
+
+func (f *Fingerprinter) frame(function string, file string, line int, remote string) string {
+	rs := function + " " + f.normalize(f.FileRules, file)
+	if f.KeepLine && line > 0 {
+		rs += ":" + strconv.Itoa(line)
+	}
+	if remote != "" {
+		rs = "[remote " + remote + "] " + rs
+	}
+	return rs
+}
+
+func (f *Fingerprinter) normalize(rules []NormalizeRule, s string) string {
+	for _, v := range rules {
+		if v.Pattern == nil {
+			continue
+		}
+		s = v.Pattern.ReplaceAllString(s, v.Replace)
+	}
+	return s
+}
+
+var traceLineNumber = regexp.MustCompile(`:\d+$`)
+
+// traceFile picks the file from a trace like '2019/8/30 17:51:42.000 /src/main.go:10'
+func traceFile(trace string) string {
+	fields := strings.Fields(trace)
+	if len(fields) == 0 {
+		return ""
+	}
+	return traceLineNumber.ReplaceAllString(fields[len(fields)-1], "")
+}
+
+// rootType returns the type of the innermost error which is not an Error, with errcode for a service error.
+func rootType(e error) string {
+	var root error
+	for v := e; v != nil; v = errors.Unwrap(v) {
+		if _, ok := v.(Error); !ok {
+			root = v
+		}
+	}
+	if se, ok := IsServiceErr(e); ok {
+		return fmt.Sprintf("errorx.ServiceError#%d", se.Errcode)
+	}
+	if root == nil {
+		return "errorx.Error"
+	}
+	return fmt.Sprintf("%T", root)
+}
+
+func rootMessage(e error) string {
+	var x Error
+	if errors.As(e, &x) {
+		return x.Message()
+	}
+	return e.Error()
+}
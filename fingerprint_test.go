@@ -0,0 +1,85 @@
+package errorx
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	var fps = make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		fps = append(fps, fingerprintUser(i).(Error).Fingerprint())
+	}
+	if len(fps[0]) != 32 || fps[0] != fps[1] || fps[1] != fps[2] {
+		fmt.Println(fps)
+		t.Fail()
+		return
+	}
+
+	// same message from another function
+	if fp := NewFromStringf("user '%d' not found", 1).(Error).Fingerprint(); fp == fps[0] {
+		fmt.Println(fp)
+		t.Fail()
+		return
+	}
+
+	// another message from the same function
+	if fp := fingerprintMessage("connect to redis time out").(Error).Fingerprint(); fp == fingerprintMessage("connect to mysql time out").(Error).Fingerprint() {
+		fmt.Println(fp)
+		t.Fail()
+		return
+	}
+
+	// plain errors are identified by type and message
+	if Fingerprint(errors.New("nil return")) != Fingerprint(fmt.Errorf("nil return")) {
+		t.Fail()
+		return
+	}
+}
+
+func TestFingerprintServiceError(t *testing.T) {
+	if Fingerprint(NewServiceError("balance not enough", 10001)) == Fingerprint(NewServiceError("balance not enough", 10002)) {
+		t.Fail()
+		return
+	}
+}
+
+func TestFingerprinter(t *testing.T) {
+	f := NewFingerprinter()
+	f.KeepLine = true
+	if f.Fingerprint(fingerprintBranch(true)) == f.Fingerprint(fingerprintBranch(false)) {
+		t.Fail()
+		return
+	}
+	f.KeepLine = false
+	if f.Fingerprint(fingerprintBranch(true)) != f.Fingerprint(fingerprintBranch(false)) {
+		t.Fail()
+		return
+	}
+
+	f.MessageRules = append(f.MessageRules, NormalizeRule{
+		Pattern: regexp.MustCompile(`redis|mysql`),
+		Replace: "<db>",
+	})
+	if f.Fingerprint(fingerprintMessage("connect to redis time out")) != f.Fingerprint(fingerprintMessage("connect to mysql time out")) {
+		t.Fail()
+		return
+	}
+}
+
+func fingerprintUser(id int) error {
+	return NewFromStringf("user '%d' not found, id=%d, trace=0x%x", id, id, id*255)
+}
+
+func fingerprintMessage(msg string) error {
+	return NewFromString(msg)
+}
+
+func fingerprintBranch(b bool) error {
+	if b {
+		return NewFromString("nil return")
+	}
+	return NewFromString("nil return")
+}
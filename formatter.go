@@ -0,0 +1,67 @@
+package errorx
+
+import (
+	"fmt"
+	"io"
+)
+
+// Message returns the root message of an error, without stack, header or context.
+func (e Error) Message() string {
+	if v, ok := e.E.(Error); ok {
+		return v.Message()
+	}
+	if e.E != nil {
+		return e.E.Error()
+	}
+	if n := len(e.stackTracesV2); n > 0 {
+		return e.stackTracesV2[n-1].desc
+	}
+	return ""
+}
+
+// Format implements fmt.Formatter.
+//
+//	%s, %v  root message only
+//	%+v     header, stack and context, the same as Error()
+//	%q      quoted root message
+func (e Error) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			if e.isServiceErr {
+				fmt.Fprintf(s, "errcode=%d errmsg=%s\n", e.serviceErrcode, e.serviceErrmsg)
+			}
+			io.WriteString(s, e.Error())
+			return
+		}
+		io.WriteString(s, e.Message())
+	case 's':
+		io.WriteString(s, e.Message())
+	case 'q':
+		fmt.Fprintf(s, "%q", e.Message())
+	default:
+		fmt.Fprintf(s, "%%!%c(errorx.Error=%s)", verb, e.Message())
+	}
+}
+
+// Format implements fmt.Formatter.
+//
+//	%s, %v  errmsg only
+//	%+v     errcode and errmsg
+//	%q      quoted errmsg
+func (se ServiceError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "errcode=%d errmsg=%s", se.Errcode, se.Errmsg)
+			return
+		}
+		io.WriteString(s, se.Errmsg)
+	case 's':
+		io.WriteString(s, se.Errmsg)
+	case 'q':
+		fmt.Fprintf(s, "%q", se.Errmsg)
+	default:
+		fmt.Fprintf(s, "%%!%c(errorx.ServiceError=%s)", verb, se.Errmsg)
+	}
+}
@@ -0,0 +1,64 @@
+package errorx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	e := Wrap(WrapContext(fmt.Errorf("nil return"), map[string]interface{}{
+		"user_id": 1,
+	}))
+
+	if rs := fmt.Sprintf("%v", e); rs != "nil return" {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+	if rs := fmt.Sprintf("%s", e); rs != "nil return" {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+	if rs := fmt.Sprintf("%q", e); rs != `"nil return"` {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+	if rs := fmt.Sprintf("%+v", e); rs != e.Error() {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+	if rs := fmt.Sprintf("%v", New(NewFromString("nil return"))); rs != "nil return" {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+}
+
+func TestFormatServiceError(t *testing.T) {
+	se := NewServiceError("balance not enough", 10001)
+
+	if rs := fmt.Sprintf("%v", se); rs != "balance not enough" {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+	if rs := fmt.Sprintf("%+v", se); rs != "errcode=10001 errmsg=balance not enough" {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+	if rs := fmt.Sprintf("%v", Wrap(se)); rs != "balance not enough" {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+	if rs := fmt.Sprintf("%+v", Wrap(se)); !strings.HasPrefix(rs, "errcode=10001 errmsg=balance not enough\n") {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+}
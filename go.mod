@@ -1,5 +1,8 @@
 module github.com/fwhezfwhez/errorx
 
-go 1.12
+go 1.21
 
-require github.com/gofrs/uuid v4.0.0+incompatible
+require (
+	github.com/gofrs/uuid v4.0.0+incompatible
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,141 @@
+package errorx
+
+import (
+	"context"
+	"sync"
+)
+
+// GoHandler deals with errors returned or panicked by functions run by Go.
+// By default, it prints errors by DefaultHandler.
+var GoHandler = func(e error) {
+	u, _ := NewV4()
+	DefaultHandler(e, map[string]interface{}{
+		"error_uuid": u.String(),
+	})
+}
+
+// Recover turns a panic into an Error and sets it to *err. It must be deferred directly.
+// The Error records the panic value, the whole goroutine stack, and header 'panic' true.
+// When *err is already set, it's kept in 'Errors' of the panic error, so errors.Is still matches it.
+//
+//	func f() (err error) {
+//	    defer errorx.Recover(&err)
+//	    ...
+//	}
+func Recover(err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	rs := newPanicError(p, 0)
+	if err == nil {
+		GoHandler(rs)
+		return
+	}
+	if *err != nil {
+		rs.Errors = append(rs.Errors, *err)
+	}
+	*err = rs
+}
+
+// Go runs f in a new goroutine. A panic in f is recovered rather than killing the process.
+// The error f returns, or the panic turned into an Error, is passed to GoHandler.
+func Go(f func() error) {
+	go func() {
+		var e error
+		defer func() {
+			if e != nil {
+				GoHandler(e)
+			}
+		}()
+		defer Recover(&e)
+		e = f()
+	}()
+}
+
+// GroupOption configures a Group.
+type GroupOption struct {
+	// collects errors of all functions into a MultiError, otherwise only the first one is kept
+	CollectAll bool
+	// when set, each error is saved by Reporter as soon as it happens
+	Reporter *Reporter
+}
+
+// Group runs functions in goroutines, like errgroup.Group.
+// Panics in the functions are recovered as errors. The first error cancels the context of the group.
+// The zero value keeps the first error, doesn't cancel anything, and reports nothing.
+//
+//	g, ctx := errorx.NewGroup(ctx, errorx.GroupOption{CollectAll: true, Reporter: rp})
+//	for _, v := range urls {
+//	    url := v
+//	    g.Go(func() error {
+//	        return fetch(ctx, url)
+//	    })
+//	}
+//	if e := g.Wait(); e != nil {
+//	    ...
+//	}
+type Group struct {
+	opt    GroupOption
+	cancel context.CancelFunc
+
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+	errs MultiError
+}
+
+// NewGroup returns a Group and a context derived from ctx, which is canceled when a function returns an error,
+// or Wait returns.
+func NewGroup(ctx context.Context, opt GroupOption) (*Group, context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{opt: opt, cancel: cancel}, ctx
+}
+
+// Go runs f in a new goroutine.
+func (g *Group) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		var e error
+		defer func() {
+			if e != nil {
+				g.fail(e)
+			}
+		}()
+		defer Recover(&e)
+		e = f()
+	}()
+}
+
+func (g *Group) fail(e error) {
+	if g.opt.Reporter != nil {
+		g.opt.Reporter.SaveError(Wrap(e), nil)
+	}
+	if g.opt.CollectAll {
+		g.errs.Append(e)
+	}
+	g.once.Do(func() {
+		g.err = e
+		if g.cancel != nil {
+			g.cancel()
+		}
+	})
+}
+
+// Wait waits for all functions to return. It returns the first error, or a *MultiError of all errors
+// when CollectAll is set, nil if no error.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	if g.opt.CollectAll {
+		return g.errs.ErrorOrNil()
+	}
+	return g.err
+}
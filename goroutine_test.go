@@ -0,0 +1,165 @@
+package errorx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecover(t *testing.T) {
+	e := recoverPanic()
+	var x Error
+	if !errors.As(e, &x) || x.GetHeader("panic") != "true" || len(x.StackFrames()) == 0 {
+		fmt.Println(e)
+		t.Fail()
+		return
+	}
+	if !strings.Contains(x.StackTraceValue(), "goroutine_test.go:") || !strings.Contains(x.Message(), "index out of range") {
+		fmt.Println(x.Error())
+		t.Fail()
+		return
+	}
+	if recoverNothing() != io.EOF {
+		t.Fail()
+		return
+	}
+}
+
+func recoverPanic() (err error) {
+	defer Recover(&err)
+	var arr []int
+	_ = arr[1]
+	return nil
+}
+
+func recoverNothing() (err error) {
+	defer Recover(&err)
+	return io.EOF
+}
+
+func TestRecoverDeep(t *testing.T) {
+	e := recoverDeepPanic()
+	var x Error
+	if !errors.As(e, &x) {
+		fmt.Println(e)
+		t.Fail()
+		return
+	}
+	var n int
+	for _, f := range x.StackFrames() {
+		if strings.HasSuffix(f.Function, "deepPanic") {
+			n++
+		}
+	}
+	// the goroutine stack is kept whole however deep the panic is
+	if n != 101 || !strings.HasSuffix(x.StackFrames()[len(x.StackFrames())-1].Function, "goexit") {
+		fmt.Println(n)
+		t.Fail()
+		return
+	}
+}
+
+func recoverDeepPanic() (err error) {
+	defer Recover(&err)
+	deepPanic(100)
+	return nil
+}
+
+func deepPanic(depth int) {
+	if depth == 0 {
+		panic("deep")
+	}
+	deepPanic(depth - 1)
+}
+
+func TestGo(t *testing.T) {
+	var (
+		l     sync.Mutex
+		saved []error
+		wg    sync.WaitGroup
+	)
+	old := GoHandler
+	defer func() { GoHandler = old }()
+	GoHandler = func(e error) {
+		l.Lock()
+		defer l.Unlock()
+		saved = append(saved, e)
+		wg.Done()
+	}
+
+	wg.Add(2)
+	Go(func() error {
+		panic("boom")
+	})
+	Go(func() error {
+		return io.EOF
+	})
+	Go(func() error {
+		return nil
+	})
+	wg.Wait()
+
+	l.Lock()
+	defer l.Unlock()
+	if len(saved) != 2 {
+		fmt.Println(saved)
+		t.Fail()
+		return
+	}
+}
+
+func TestGroup(t *testing.T) {
+	var count int
+	rp := NewReporter("test")
+	rp.AddModeHandler("test", func(e error, ctx map[string]interface{}) {
+		count++
+	})
+
+	g, ctx := NewGroup(context.Background(), GroupOption{Reporter: rp})
+	g.Go(func() error {
+		panic("boom")
+	})
+	g.Go(func() error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+	e := g.Wait()
+	var x Error
+	if !errors.As(e, &x) || x.GetHeader("panic") != "true" || count != 2 {
+		fmt.Println(e, count)
+		t.Fail()
+		return
+	}
+
+	g, _ = NewGroup(context.Background(), GroupOption{CollectAll: true})
+	for i := 0; i < 3; i++ {
+		g.Go(func() error {
+			return io.EOF
+		})
+	}
+	g.Go(func() error {
+		return nil
+	})
+	e = g.Wait()
+	if me, ok := e.(*MultiError); !ok || me.Len() != 3 || !errors.Is(e, io.EOF) {
+		fmt.Println(e)
+		t.Fail()
+		return
+	}
+
+	var zero Group
+	zero.Go(func() error { return nil })
+	if zero.Wait() != nil {
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,265 @@
+package errorx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// JSONVersion is the version of the json schema an Error is marshalled into.
+// UnmarshalJSON refuses data with a newer version.
+//
+// Schema of version 1:
+//
+//	{
+//	  "version": 1,
+//	  "message": "root message, the same as Message()",
+//	  "error": "origin error message, set when 'E' is an official error",
+//	  "cause": {...},                                // 'E' when it's an Error, in the same schema
+//	  "service_error": {"errcode": 10001, "errmsg": "balance not enough", "status": 400, "type": "", "detail": ""},
+//	  "errors": [{"error": "...", "cause": {...}, "service_error": {...}}], // 'Errors', each like the origin above
+//	  "stack": [{"trace": "2019/8/30 17:51:42.000 /src/main.go:10", "desc": "nil return", "remote": "user-service",
+//	             "function": "main.main", "file": "/src/main.go", "line": 10,
+//	             "attrs": [{"key": "user_id", "kind": "int64", "value": 1}],
+//	             "described": true}],                // attrs are in desc as well, see WrapContext
+//	  "frames": [{"function": "main.main", "file": "/src/main.go", "line": 10}],
+//	  "header": {"api": ["/user/info"]},
+//	  "context": {"user_id": 1},
+//	  "flag": 7,
+//	  "keyword": ""
+//	}
+//
+// Values in context are restored as what encoding/json decodes into interface{}, numbers become float64.
+// Attrs are restored into the type of their kind.
+// A service error wrapped by an official origin error, like fmt.Errorf("pay: %w", se), is kept in 'service_error',
+// and the decoded origin error still unwraps to it.
+const JSONVersion = 1
+
+type jsonError struct {
+	Version      int                    `json:"version"`
+	Message      string                 `json:"message"`
+	Error        string                 `json:"error,omitempty"`
+	Cause        *Error                 `json:"cause,omitempty"`
+	ServiceError *jsonServiceError      `json:"service_error,omitempty"`
+	Errors       []jsonOrigin           `json:"errors,omitempty"`
+	Stack        []jsonStackline        `json:"stack"`
+	Frames       []Frame                `json:"frames,omitempty"`
+	Header       map[string][]string    `json:"header,omitempty"`
+	Context      map[string]interface{} `json:"context,omitempty"`
+	Flag         int                    `json:"flag"`
+	Keyword      string                 `json:"keyword,omitempty"`
+}
+
+// jsonOrigin is an error saved in 'Errors'.
+type jsonOrigin struct {
+	Error        string            `json:"error,omitempty"`
+	Cause        *Error            `json:"cause,omitempty"`
+	ServiceError *jsonServiceError `json:"service_error,omitempty"`
+}
+
+type jsonServiceError struct {
+	Errcode int    `json:"errcode"`
+	Errmsg  string `json:"errmsg"`
+	Status  int    `json:"status,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+type jsonStackline struct {
+	Trace    string `json:"trace"`
+	Desc     string `json:"desc"`
+	Remote   string `json:"remote,omitempty"`
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Attrs    []Attr `json:"attrs,omitempty"`
+	// Attrs are in Desc as well, see WrapContext
+	Described bool `json:"described,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e Error) MarshalJSON() ([]byte, error) {
+	var tmp = jsonError{
+		Version: JSONVersion,
+		Message: e.Message(),
+		Stack:   make([]jsonStackline, 0, len(e.stackTracesV2)),
+		Frames:  e.StackFrames(),
+		Header:  e.Header,
+		Context: jsonSafeContext(e.Context),
+		Flag:    e.Flag,
+		Keyword: e.Keyword,
+	}
+
+	origin := encodeOrigin(e.E)
+	tmp.Error, tmp.Cause, tmp.ServiceError = origin.Error, origin.Cause, origin.ServiceError
+	for _, v := range e.Errors {
+		if v != nil {
+			tmp.Errors = append(tmp.Errors, encodeOrigin(v))
+		}
+	}
+
+	if e.isServiceErr && tmp.ServiceError == nil {
+		tmp.ServiceError = &jsonServiceError{
+			Errcode: e.serviceErrcode,
+			Errmsg:  e.serviceErrmsg,
+		}
+	}
+
+	for _, v := range e.stackTracesV2 {
+		tmp.Stack = append(tmp.Stack, jsonStackline{
+			Trace:     v.trace,
+			Desc:      v.desc,
+			Remote:    v.remote,
+			Function:  v.function(),
+			File:      v.file,
+			Line:      v.line,
+			Attrs:     v.attrs,
+			Described: v.described,
+		})
+	}
+
+	return json.Marshal(tmp)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// Stack(), GetHeader(), BasicError() and IsServiceErr() of the decoded error act the same as the marshalled one.
+func (e *Error) UnmarshalJSON(buf []byte) error {
+	var tmp jsonError
+	if er := json.Unmarshal(buf, &tmp); er != nil {
+		return er
+	}
+	if tmp.Version <= 0 || tmp.Version > JSONVersion {
+		return fmt.Errorf("errorx: unsupported json version %d, supports up to %d", tmp.Version, JSONVersion)
+	}
+
+	rs := empty()
+	rs.Flag = tmp.Flag
+	rs.Keyword = tmp.Keyword
+	rs.Header = tmp.Header
+	rs.frames = tmp.Frames
+	if tmp.Context != nil {
+		rs.Context = tmp.Context
+	}
+
+	for _, v := range tmp.Stack {
+		rs.stackTracesV2 = append(rs.stackTracesV2, stackline{
+			trace:     v.Trace,
+			desc:      v.Desc,
+			remote:    v.Remote,
+			fn:        v.Function,
+			file:      v.File,
+			line:      v.Line,
+			attrs:     v.Attrs,
+			described: v.Described,
+		})
+	}
+
+	if tmp.ServiceError != nil {
+		rs.isServiceErr = true
+		rs.serviceErrcode = tmp.ServiceError.Errcode
+		rs.serviceErrmsg = tmp.ServiceError.Errmsg
+	}
+
+	rs.E = jsonOrigin{Error: tmp.Error, Cause: tmp.Cause, ServiceError: tmp.ServiceError}.decode()
+	switch {
+	case tmp.Errors != nil:
+		for _, v := range tmp.Errors {
+			rs.Errors = append(rs.Errors, v.decode())
+		}
+	case tmp.Cause == nil && tmp.Error != "":
+		// made by an old version without 'errors'
+		rs.Errors = append(rs.Errors, rs.E)
+	}
+
+	*e = rs
+	return nil
+}
+
+// encodeOrigin describes err, a service error it wraps is kept as well.
+func encodeOrigin(err error) jsonOrigin {
+	var rs jsonOrigin
+	switch v := err.(type) {
+	case nil:
+	case Error:
+		rs.Cause = &v
+	case ServiceError:
+		rs.ServiceError = encodeServiceError(v)
+	default:
+		rs.Error = v.Error()
+		var se ServiceError
+		if errors.As(v, &se) {
+			rs.ServiceError = encodeServiceError(se)
+		}
+	}
+	return rs
+}
+
+func encodeServiceError(se ServiceError) *jsonServiceError {
+	return &jsonServiceError{
+		Errcode: se.Errcode,
+		Errmsg:  se.Errmsg,
+		Status:  se.Status,
+		Type:    se.Type,
+		Detail:  se.Detail,
+	}
+}
+
+// decode rebuilds the error described by encodeOrigin, nil if it's empty.
+func (o jsonOrigin) decode() error {
+	var se *ServiceError
+	if o.ServiceError != nil {
+		se = &ServiceError{
+			Errcode: o.ServiceError.Errcode,
+			Errmsg:  o.ServiceError.Errmsg,
+			Status:  o.ServiceError.Status,
+			Type:    o.ServiceError.Type,
+			Detail:  o.ServiceError.Detail,
+		}
+	}
+	switch {
+	case o.Cause != nil:
+		return *o.Cause
+	case o.Error != "" && se != nil:
+		return decodedError{msg: o.Error, se: *se}
+	case o.Error != "":
+		return errors.New(o.Error)
+	case se != nil:
+		return *se
+	}
+	return nil
+}
+
+// decodedError is an official error decoded from json, which wrapped a service error.
+type decodedError struct {
+	msg string
+	se  ServiceError
+}
+
+func (e decodedError) Error() string {
+	return e.msg
+}
+
+func (e decodedError) Unwrap() error {
+	return e.se
+}
+
+// jsonSafeContext makes sure context can be marshalled.
+// Values can't be marshalled are replaced with their '%v' format.
+func jsonSafeContext(context map[string]interface{}) map[string]interface{} {
+	if len(context) == 0 {
+		return nil
+	}
+	if _, er := json.Marshal(context); er == nil {
+		return context
+	}
+
+	var rs = make(map[string]interface{}, len(context))
+	for k, v := range context {
+		if _, er := json.Marshal(v); er != nil {
+			rs[k] = fmt.Sprintf("%v", v)
+			continue
+		}
+		rs[k] = v
+	}
+	return rs
+}
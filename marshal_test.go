@@ -0,0 +1,171 @@
+package errorx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestErrorJSON(t *testing.T) {
+	src := NewWithHeader(WrapContext(Wrap(NewServiceError("balance not enough", 10001)), map[string]interface{}{
+		"user_id": 1,
+	}), map[string]interface{}{
+		"api": "/pay/order",
+	}).(Error)
+
+	buf, e := json.Marshal(src)
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	fmt.Println(string(buf))
+
+	var dest Error
+	if e := json.Unmarshal(buf, &dest); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+
+	if !reflect.DeepEqual(src.Stack(), dest.Stack()) {
+		fmt.Println(src.Stack(), dest.Stack())
+		t.Fail()
+		return
+	}
+	if dest.GetHeader("api") != "/pay/order" {
+		t.Fail()
+		return
+	}
+	if src.BasicError() != dest.BasicError() || src.Message() != dest.Message() {
+		fmt.Println(src.BasicError(), dest.BasicError())
+		t.Fail()
+		return
+	}
+	se, ok := IsServiceErr(dest)
+	if !ok || se.Errcode != 10001 || se.Errmsg != "balance not enough" {
+		fmt.Println(se, ok)
+		t.Fail()
+		return
+	}
+	if _, ok := IsServiceErr(dest, NewServiceError("balance not enough", 10001)); !ok {
+		t.Fail()
+		return
+	}
+}
+
+func TestErrorJSONBasic(t *testing.T) {
+	src := Wrap(NewWithStack(errors.New("nil return"))).(Error)
+
+	buf, e := json.Marshal(src)
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+
+	var dest Error
+	if e := json.Unmarshal(buf, &dest); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	if !reflect.DeepEqual(src.Stack(), dest.Stack()) || !reflect.DeepEqual(src.StackFrames(), dest.StackFrames()) {
+		fmt.Println(src.Stack(), dest.Stack())
+		t.Fail()
+		return
+	}
+	if dest.BasicError() != "nil return" || dest.Message() != "nil return" {
+		fmt.Println(dest.BasicError())
+		t.Fail()
+		return
+	}
+	if _, ok := IsServiceErr(dest); ok {
+		t.Fail()
+		return
+	}
+
+	if e := json.Unmarshal([]byte(`{"version": 99}`), &dest); e == nil {
+		fmt.Println("newer version should be refused")
+		t.Fail()
+		return
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	src := NewFromString("nil return")
+	errUUID, buf, e := JSON(src, map[string]interface{}{
+		"api": "/xx/xxx/xx",
+	})
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+
+	u, dest, context, e := ParseJSON(buf)
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	if u != errUUID || context["api"] != "/xx/xxx/xx" {
+		fmt.Println(u, context)
+		t.Fail()
+		return
+	}
+	if !reflect.DeepEqual(src.(Error).Stack(), dest.Stack()) {
+		fmt.Println(src.(Error).Stack(), dest.Stack())
+		t.Fail()
+		return
+	}
+}
+
+func TestErrorJSONWrappedServiceError(t *testing.T) {
+	src := Wrap(fmt.Errorf("pay: %w", NewServiceError("balance not enough", 10001))).(Error)
+	buf, _ := json.Marshal(src)
+
+	var dest Error
+	if e := json.Unmarshal(buf, &dest); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	se, ok := IsServiceErr(dest)
+	if !ok || se.Errcode != 10001 || dest.BasicError() != src.BasicError() {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+	var target ServiceError
+	if !errors.As(dest, &target) || target.Errmsg != "balance not enough" {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+}
+
+func TestErrorJSONErrors(t *testing.T) {
+	src := GroupErrors(errors.New("nil return"), NewServiceError("balance not enough", 10001)).(Error)
+	buf, _ := json.Marshal(src)
+
+	var dest Error
+	if e := json.Unmarshal(buf, &dest); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	if len(dest.Errors) != 2 || dest.Errors[0].Error() != "nil return" {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+	var target ServiceError
+	if !errors.As(dest, &target) || target.Errcode != 10001 {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,249 @@
+package errorx
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MetricLabels breaks metrics down. Fields not applying to a metric are left empty.
+type MetricLabels struct {
+	Mode    string `json:"mode,omitempty"`
+	Handler string `json:"handler,omitempty"`
+	// errcode of service errors, see IsServiceErr
+	Code int `json:"code,omitempty"`
+}
+
+// DefaultBuckets are upper bounds of histogram buckets in seconds, from 1ms to 10s.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// Metrics keeps counters and latency histograms of Reporter and errorCollection, without a metrics dependency.
+// It implements expvar.Var, and is not published unless asked to, by package expvarmetrics or expvar.Publish.
+// Read it by Snapshot, or by /debug/vars once published.
+//
+// Metrics of Reporter:
+//
+//	reporter_saved            errors saved, by mode and code
+//	reporter_deduplicated     errors suppressed by deduplication, by mode and code
+//	reporter_sampled_out      errors dropped by samplers, by mode and code
+//	reporter_handled          errors passed to handler, by mode, handler and code
+//	reporter_handle_seconds   histogram of handler latency, by mode and handler
+//	reporter_sink_failed      failed writes of sinks, by mode and handler(type of sink)
+//	reporter_async_retried    retried requests of asynchronous delivery
+//	reporter_async_dropped    reports dropped by asynchronous delivery
+//
+// Metrics of errorCollection:
+//
+//	collection_queued          errors added to queue, by code
+//	collection_dropped         errors dropped, by code
+//	collection_handled         errors handled, by handler and code, handlers of pipelines count instead of pipelines
+//	collection_handle_seconds  histogram of handling latency, by handler, like collection_handled
+//	collection_handler_failed  errors returned or panicked by pipeline handlers, by handler and code
+//	collection_retried         retries of the Retry middleware, by handler and code
+type Metrics struct {
+	buckets []float64
+
+	l          sync.Mutex
+	counters   map[metricKey]int64
+	histograms map[metricKey]*histogram
+}
+
+type metricKey struct {
+	name   string
+	labels MetricLabels
+}
+
+type histogram struct {
+	count  int64
+	sum    float64
+	counts []int64
+}
+
+// NewMetrics returns metrics with histogram buckets, DefaultBuckets if buckets is empty.
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		buckets:    buckets,
+		counters:   make(map[metricKey]int64, 0),
+		histograms: make(map[metricKey]*histogram, 0),
+	}
+}
+
+// DefaultMetrics is used by Reporters and collections without their own metrics.
+var DefaultMetrics = NewMetrics()
+
+// Add adds n to counter name. A nil Metrics records nothing.
+func (m *Metrics) Add(name string, labels MetricLabels, n int64) {
+	if m == nil {
+		return
+	}
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.counters[metricKey{name: name, labels: labels}] += n
+}
+
+// Observe records d into histogram name.
+func (m *Metrics) Observe(name string, labels MetricLabels, d time.Duration) {
+	if m == nil {
+		return
+	}
+	seconds := d.Seconds()
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	key := metricKey{name: name, labels: labels}
+	h, ok := m.histograms[key]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(m.buckets))}
+		m.histograms[key] = h
+	}
+	h.count++
+	h.sum += seconds
+	for i, le := range m.buckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+}
+
+// MetricsSnapshot is metrics at a moment, sorted by name and labels.
+type MetricsSnapshot struct {
+	Counters   []CounterSnapshot   `json:"counters"`
+	Histograms []HistogramSnapshot `json:"histograms"`
+}
+
+type CounterSnapshot struct {
+	Name   string       `json:"name"`
+	Labels MetricLabels `json:"labels"`
+	Value  int64        `json:"value"`
+}
+
+// HistogramSnapshot counts observations in buckets, cumulatively like prometheus, so the last bucket is Count
+// when no observation is above it.
+type HistogramSnapshot struct {
+	Name    string       `json:"name"`
+	Labels  MetricLabels `json:"labels"`
+	Count   int64        `json:"count"`
+	Sum     float64      `json:"sum"`
+	Buckets []Bucket     `json:"buckets"`
+}
+
+type Bucket struct {
+	// upper bound in seconds
+	Le    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+// Snapshot copies metrics.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	var rs = MetricsSnapshot{
+		Counters:   make([]CounterSnapshot, 0),
+		Histograms: make([]HistogramSnapshot, 0),
+	}
+	if m == nil {
+		return rs
+	}
+
+	m.l.Lock()
+	for k, v := range m.counters {
+		rs.Counters = append(rs.Counters, CounterSnapshot{Name: k.name, Labels: k.labels, Value: v})
+	}
+	for k, v := range m.histograms {
+		hs := HistogramSnapshot{Name: k.name, Labels: k.labels, Count: v.count, Sum: v.sum, Buckets: make([]Bucket, 0, len(m.buckets))}
+		var cumulative int64
+		for i, le := range m.buckets {
+			cumulative += v.counts[i]
+			hs.Buckets = append(hs.Buckets, Bucket{Le: le, Count: cumulative})
+		}
+		rs.Histograms = append(rs.Histograms, hs)
+	}
+	m.l.Unlock()
+
+	sort.Slice(rs.Counters, func(i, j int) bool {
+		return lessMetric(rs.Counters[i].Name, rs.Counters[i].Labels, rs.Counters[j].Name, rs.Counters[j].Labels)
+	})
+	sort.Slice(rs.Histograms, func(i, j int) bool {
+		return lessMetric(rs.Histograms[i].Name, rs.Histograms[i].Labels, rs.Histograms[j].Name, rs.Histograms[j].Labels)
+	})
+	return rs
+}
+
+func lessMetric(name1 string, l1 MetricLabels, name2 string, l2 MetricLabels) bool {
+	switch {
+	case name1 != name2:
+		return name1 < name2
+	case l1.Mode != l2.Mode:
+		return l1.Mode < l2.Mode
+	case l1.Handler != l2.Handler:
+		return l1.Handler < l2.Handler
+	}
+	return l1.Code < l2.Code
+}
+
+// Counter returns the value of counter name with labels.
+func (m *Metrics) Counter(name string, labels MetricLabels) int64 {
+	if m == nil {
+		return 0
+	}
+	m.l.Lock()
+	defer m.l.Unlock()
+	return m.counters[metricKey{name: name, labels: labels}]
+}
+
+// Reset drops all metrics.
+func (m *Metrics) Reset() {
+	if m == nil {
+		return
+	}
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.counters = make(map[metricKey]int64, 0)
+	m.histograms = make(map[metricKey]*histogram, 0)
+}
+
+// String implements expvar.Var, it's the json of Snapshot.
+func (m *Metrics) String() string {
+	buf, _ := json.Marshal(m.Snapshot())
+	return string(buf)
+}
+
+// ErrorCode returns the errcode of e if it's a service error, or 0, used as MetricLabels.Code.
+func ErrorCode(e error) int {
+	if se, ok := IsServiceErr(e); ok {
+		return se.Errcode
+	}
+	return 0
+}
+
+// SetMetrics makes r record metrics into m rather than DefaultMetrics.
+func (r *Reporter) SetMetrics(m *Metrics) *Reporter {
+	if r.shared == nil {
+		r.shared = &reporterShared{}
+	}
+	r.shared.l.Lock()
+	defer r.shared.l.Unlock()
+	r.shared.metrics = m
+	return r
+}
+
+func (r *Reporter) metrics() *Metrics {
+	return r.shared.metricsOrDefault()
+}
+
+func (s *reporterShared) metricsOrDefault() *Metrics {
+	if s == nil {
+		return DefaultMetrics
+	}
+	s.l.RLock()
+	defer s.l.RUnlock()
+	if s.metrics != nil {
+		return s.metrics
+	}
+	return DefaultMetrics
+}
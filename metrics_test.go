@@ -0,0 +1,73 @@
+package errorx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(0.01, 0.1)
+	m.Add("reporter_saved", MetricLabels{Mode: "pro", Code: 10001}, 2)
+	m.Add("reporter_saved", MetricLabels{Mode: "dev"}, 1)
+	m.Observe("reporter_handle_seconds", MetricLabels{Mode: "pro"}, 5*time.Millisecond)
+	m.Observe("reporter_handle_seconds", MetricLabels{Mode: "pro"}, 50*time.Millisecond)
+	m.Observe("reporter_handle_seconds", MetricLabels{Mode: "pro"}, time.Second)
+
+	snapshot := m.Snapshot()
+	if len(snapshot.Counters) != 2 || snapshot.Counters[0].Labels.Mode != "dev" || snapshot.Counters[1].Value != 2 {
+		fmt.Println(snapshot.Counters)
+		t.Fail()
+		return
+	}
+	h := snapshot.Histograms[0]
+	if h.Count != 3 || h.Buckets[0].Count != 1 || h.Buckets[1].Count != 2 {
+		fmt.Println(h)
+		t.Fail()
+		return
+	}
+
+	var tmp MetricsSnapshot
+	if e := json.Unmarshal([]byte(m.String()), &tmp); e != nil || len(tmp.Counters) != 2 {
+		fmt.Println(m.String())
+		t.Fail()
+		return
+	}
+
+	var nilMetrics *Metrics
+	nilMetrics.Add("reporter_saved", MetricLabels{}, 1)
+	nilMetrics.Reset()
+
+	m.Reset()
+	if len(m.Snapshot().Counters) != 0 {
+		t.Fail()
+		return
+	}
+}
+
+func TestReporterMetrics(t *testing.T) {
+	m := NewMetrics()
+	rp := NewReporter("pro")
+	rp.SetMetrics(m)
+	rp.AddModeHandler("pro", func(e error, context map[string]interface{}) {})
+	rp.SetSampler("pro", RateSampler(0))
+
+	rp.SaveError(Wrap(NewServiceError("balance not enough", 10001)), nil)
+	rp.SetSampler("pro", nil)
+	rp.SaveError(errors.New("nil return"), nil)
+
+	if m.Counter("reporter_saved", MetricLabels{Mode: "pro", Code: 10001}) != 1 ||
+		m.Counter("reporter_sampled_out", MetricLabels{Mode: "pro", Code: 10001}) != 1 ||
+		m.Counter("reporter_handled", MetricLabels{Mode: "pro", Handler: "mode_handler"}) != 1 {
+		fmt.Println(m.String())
+		t.Fail()
+		return
+	}
+	if hs := m.Snapshot().Histograms; len(hs) != 1 || hs[0].Labels.Handler != "mode_handler" || hs[0].Count != 1 {
+		fmt.Println(m.String())
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,109 @@
+package errorx
+
+import (
+	"net/http"
+)
+
+// HeaderErrorUUID is the default response header carrying the error uuid to the client.
+const HeaderErrorUUID = "X-Error-UUID"
+
+// Middleware recovers panics of net/http handlers, saves them by Reporter with request info, and returns the error uuid
+// to the client.
+//
+//	mw := errorx.NewMiddleware(rp.Mode("pro"), "User-Agent", "X-Request-Id")
+//	http.ListenAndServe(":8080", mw.Handler(mux))
+type Middleware struct {
+	// errors are saved by Reporter.SaveError, nil means printing by DefaultHandler
+	Reporter *Reporter
+	// request headers recorded into context
+	Headers []string
+	// response header carrying the error uuid, HeaderErrorUUID is used when empty
+	UUIDHeader string
+}
+
+func NewMiddleware(rp *Reporter, headers ...string) *Middleware {
+	return &Middleware{
+		Reporter: rp,
+		Headers:  headers,
+	}
+}
+
+// Handler recovers panics of next.
+// A panic is turned into an Error with the goroutine stack, saved, and answered as a 500 problem carrying the error uuid.
+// http.ErrAbortHandler is not recovered, net/http uses it to abort a response.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			m.writeError(w, r, newPanicError(p, 0))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleError serves f, and deals with the error f returns.
+// A service error is written as a problem directly, other errors are saved like panics in Handler.
+// HandleError doesn't recover panics, wrap it by Handler for that.
+func (m *Middleware) HandleError(f ProblemHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := f(w, r)
+		if e == nil {
+			return
+		}
+		if _, ok := IsServiceErr(e); ok {
+			WriteProblem(w, r, e)
+			return
+		}
+		m.writeError(w, r, e)
+	})
+}
+
+func (m *Middleware) writeError(w http.ResponseWriter, r *http.Request, e error) {
+	p := NewProblem(e)
+	p.ErrorUUID = m.save(e, m.requestContext(r))
+
+	name := m.UUIDHeader
+	if name == "" {
+		name = HeaderErrorUUID
+	}
+	w.Header().Set(name, p.ErrorUUID)
+	writeProblem(w, r, &p)
+}
+
+func (m *Middleware) save(e error, context map[string]interface{}) string {
+	if m.Reporter != nil {
+		return m.Reporter.SaveError(e, context)
+	}
+
+	u, _ := NewV4()
+	context["error_uuid"] = u.String()
+	DefaultHandler(e, context)
+	return u.String()
+}
+
+// requestContext records method, path, query, remote address and selected headers of r.
+func (m *Middleware) requestContext(r *http.Request) map[string]interface{} {
+	var context = map[string]interface{}{
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"query":       r.URL.RawQuery,
+		"remote_addr": r.RemoteAddr,
+	}
+
+	if len(m.Headers) != 0 {
+		var header = make(map[string]string, len(m.Headers))
+		for _, k := range m.Headers {
+			if v := r.Header.Get(k); v != "" {
+				header[k] = v
+			}
+		}
+		context["header"] = header
+	}
+	return context
+}
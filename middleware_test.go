@@ -0,0 +1,96 @@
+package errorx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var (
+		saved   error
+		context map[string]interface{}
+	)
+	rp := NewReporter("test")
+	rp.AddModeHandler("test", func(e error, ctx map[string]interface{}) {
+		saved = e
+		context = ctx
+	})
+
+	mw := NewMiddleware(rp, "User-Agent")
+	h := mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["nil map"] = 1
+	}))
+
+	req := httptest.NewRequest("GET", "/user/info?id=1", nil)
+	req.Header.Set("User-Agent", "errorx-test")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		fmt.Println(w.Code)
+		t.Fail()
+		return
+	}
+	errUUID := w.Header().Get(HeaderErrorUUID)
+	if errUUID == "" || errUUID != context["error_uuid"] || !strings.Contains(w.Body.String(), errUUID) {
+		fmt.Println(errUUID, context)
+		t.Fail()
+		return
+	}
+	if context["method"] != "GET" || context["path"] != "/user/info" || context["query"] != "id=1" ||
+		context["header"].(map[string]string)["User-Agent"] != "errorx-test" {
+		fmt.Println(context)
+		t.Fail()
+		return
+	}
+
+	var x Error
+	if !errors.As(saved, &x) || x.GetHeader("panic") != "true" {
+		fmt.Println(saved)
+		t.Fail()
+		return
+	}
+	if !strings.Contains(x.StackTraceValue(), "middleware_test.go:26 panic: assignment to entry in nil map") {
+		fmt.Println(x.Stack())
+		t.Fail()
+		return
+	}
+	fmt.Println(x.Error())
+}
+
+func TestMiddlewareHandleError(t *testing.T) {
+	var count int
+	rp := NewReporter("test")
+	rp.AddModeHandler("test", func(e error, ctx map[string]interface{}) {
+		count++
+	})
+
+	mw := NewMiddleware(rp)
+	h := mw.HandleError(func(w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Path == "/service" {
+			return NewServiceError("balance not enough", 10001)
+		}
+		return NewFromString("nil return")
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/service", nil))
+	if w.Code != DefaultServiceErrorStatus || w.Header().Get(HeaderErrorUUID) != "" || count != 0 {
+		fmt.Println(w.Code, w.Header(), count)
+		t.Fail()
+		return
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/internal", nil))
+	if w.Code != http.StatusInternalServerError || w.Header().Get(HeaderErrorUUID) == "" || count != 1 {
+		fmt.Println(w.Code, w.Header(), count)
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,163 @@
+package errorx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MultiError keeps a group of errors, each member keeps its own identity and stack.
+// errors.Is and errors.As match any member. It's safe to append from several goroutines.
+// The zero value is ready to use, a MultiError must not be copied after first use.
+//
+//	var me errorx.MultiError
+//	for _, v := range jobs {
+//	    if e := v.Run(); e != nil {
+//	        me.Append(errorx.Wrap(e))
+//	    }
+//	}
+//	return me.ErrorOrNil()
+type MultiError struct {
+	l      sync.RWMutex
+	errors []error
+}
+
+// NewMultiError news a MultiError of es, nil errors are skipped.
+func NewMultiError(es ...error) *MultiError {
+	m := &MultiError{}
+	m.Append(es...)
+	return m
+}
+
+// Append adds es as members, nil errors are skipped.
+func (m *MultiError) Append(es ...error) *MultiError {
+	m.l.Lock()
+	defer m.l.Unlock()
+	for _, v := range es {
+		if v == nil {
+			continue
+		}
+		m.errors = append(m.errors, v)
+	}
+	return m
+}
+
+// Errors returns a copy of members.
+func (m *MultiError) Errors() []error {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	return append([]error(nil), m.errors...)
+}
+
+func (m *MultiError) Len() int {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	return len(m.errors)
+}
+
+// Unwrap returns members, so errors.Is and errors.As walk through them.
+func (m *MultiError) Unwrap() []error {
+	return m.Errors()
+}
+
+// ErrorOrNil returns nil when m has no member, or m itself.
+func (m *MultiError) ErrorOrNil() error {
+	if m == nil || m.Len() == 0 {
+		return nil
+	}
+	return m
+}
+
+// Error renders members as an indented tree, members which are Error come with their stack lines.
+//
+//	2 errors occurred:
+//	  [0] nil return
+//	      2019/8/30 17:51:42.000 /src/main.go:10 nil return
+//	  [1] 2 errors occurred:
+//	        [0] connect to redis time out
+//	        [1] connect to mysql time out
+func (m *MultiError) Error() string {
+	var b strings.Builder
+	writeMultiError(&b, m, "")
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func writeMultiError(b *strings.Builder, m *MultiError, indent string) {
+	es := m.Errors()
+	fmt.Fprintf(b, "%d errors occurred:\n", len(es))
+	for i, v := range es {
+		prefix := fmt.Sprintf("%s  [%d] ", indent, i)
+		child := indent + "      "
+		b.WriteString(prefix)
+
+		if me, ok := v.(*MultiError); ok {
+			writeMultiError(b, me, child)
+			continue
+		}
+
+		var x Error
+		if errors.As(v, &x) {
+			b.WriteString(x.Message() + "\n")
+			for _, line := range x.Stack() {
+				b.WriteString(child + line + "\n")
+			}
+			continue
+		}
+
+		lines := strings.Split(v.Error(), "\n")
+		b.WriteString(lines[0] + "\n")
+		for _, line := range lines[1:] {
+			b.WriteString(child + line + "\n")
+		}
+	}
+}
+
+// MarshalJSON implements json.Marshaler. Members are marshalled as an array in the schema of Error, see JSONVersion.
+func (m *MultiError) MarshalJSON() ([]byte, error) {
+	es := m.Errors()
+	var rs = make([]interface{}, 0, len(es))
+	for _, v := range es {
+		switch v.(type) {
+		case Error, *MultiError:
+			rs = append(rs, v)
+		default:
+			x := empty()
+			x.E = v
+			x.Errors = append(x.Errors, v)
+			rs = append(rs, x)
+		}
+	}
+	return json.Marshal(rs)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Members are restored as Error, or *MultiError for nested arrays.
+func (m *MultiError) UnmarshalJSON(buf []byte) error {
+	var tmp []json.RawMessage
+	if er := json.Unmarshal(buf, &tmp); er != nil {
+		return er
+	}
+
+	var es = make([]error, 0, len(tmp))
+	for _, v := range tmp {
+		if raw := strings.TrimSpace(string(v)); strings.HasPrefix(raw, "[") {
+			var me MultiError
+			if er := json.Unmarshal(v, &me); er != nil {
+				return er
+			}
+			es = append(es, &me)
+			continue
+		}
+		var x Error
+		if er := json.Unmarshal(v, &x); er != nil {
+			return er
+		}
+		es = append(es, x)
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.errors = es
+	return nil
+}
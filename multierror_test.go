@@ -0,0 +1,84 @@
+package errorx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMultiError(t *testing.T) {
+	var me MultiError
+	if me.ErrorOrNil() != nil {
+		t.Fail()
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			me.Append(NewFromString("nil return"), nil)
+		}()
+	}
+	wg.Wait()
+	if me.Len() != 10 {
+		fmt.Println(me.Len())
+		t.Fail()
+		return
+	}
+
+	me.Append(NewServiceError("balance not enough", 10001), NewMultiError(io.EOF))
+	e := me.ErrorOrNil()
+	if !errors.Is(e, io.EOF) {
+		t.Fail()
+		return
+	}
+	var se ServiceError
+	if !errors.As(e, &se) || se.Errcode != 10001 {
+		fmt.Println(se)
+		t.Fail()
+		return
+	}
+
+	if !strings.Contains(e.Error(), "12 errors occurred:\n  [0] nil return\n      ") ||
+		!strings.HasSuffix(e.Error(), "  [11] 1 errors occurred:\n        [0] EOF") {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+}
+
+func TestMultiErrorJSON(t *testing.T) {
+	me := NewMultiError(NewFromString("nil return"), io.EOF, NewMultiError(io.ErrUnexpectedEOF))
+	buf, er := json.Marshal(me)
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+
+	var rs MultiError
+	if er := json.Unmarshal(buf, &rs); er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	es := rs.Errors()
+	if len(es) != 3 || es[0].(Error).Message() != "nil return" || es[1].(Error).Message() != "EOF" || es[2].(*MultiError).Len() != 1 {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+}
+
+func TestGroupErrorsIs(t *testing.T) {
+	if e := GroupErrors(io.EOF, nil, io.ErrUnexpectedEOF); !errors.Is(e, io.ErrUnexpectedEOF) {
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,64 @@
+package errorx
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// newPanicError makes an Error from a recovered value p.
+// It records the whole goroutine stack, however deep, and sets header 'panic' true, skip is the number of frames to skip above
+// the caller of newPanicError, 0 means the stack starts from the caller.
+// Its stack line points to where the panic happens.
+func newPanicError(p interface{}, skip int) Error {
+	rs := empty()
+	rs.Flag |= Lfullstack
+	switch v := p.(type) {
+	case error:
+		rs.E = v
+		rs.Errors = append(rs.Errors, v)
+	default:
+		rs.E = fmt.Errorf("%v", v)
+	}
+
+	rs.pcs = callers(skip + 3)
+	site := panicSite(rs.pcs)
+	rs.wrapStackLineWithTrace(formatTrace(rs.Flag, site.File, site.Line), fmt.Sprintf("panic: %v", p))
+	rs.stackTracesV2[0].fn = site.Function
+	rs.stackTracesV2[0].file = site.File
+	rs.stackTracesV2[0].line = site.Line
+	rs.SetHeader("panic", "true")
+	return rs
+}
+
+// panicSite finds the frame that calls panic.
+func panicSite(pcs []uintptr) runtime.Frame {
+	var (
+		first, site runtime.Frame
+		afterPanic  bool
+	)
+
+	frames := runtime.CallersFrames(pcs)
+	for i := 0; ; i++ {
+		f, more := frames.Next()
+		if i == 0 {
+			first = f
+		}
+		// skip runtime frames such as runtime.panicmem, to find the frame in user code
+		if afterPanic && !strings.HasPrefix(f.Function, "runtime.") {
+			site = f
+			break
+		}
+		if f.Function == "runtime.gopanic" {
+			afterPanic = true
+		}
+		if !more {
+			break
+		}
+	}
+
+	if site.File == "" {
+		site = first
+	}
+	return site
+}
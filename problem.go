@@ -0,0 +1,110 @@
+package errorx
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ContentTypeProblem is the content type of RFC 7807 problem details.
+const ContentTypeProblem = "application/problem+json"
+
+// DefaultServiceErrorStatus is the HTTP status of a service error whose Status is 0.
+var DefaultServiceErrorStatus = http.StatusBadRequest
+
+// Problem is the RFC 7807 problem details of an error.
+// 'errcode', 'errmsg' and 'error_uuid' are extension members.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	Errcode   int    `json:"errcode,omitempty"`
+	Errmsg    string `json:"errmsg,omitempty"`
+	ErrorUUID string `json:"error_uuid,omitempty"`
+}
+
+// NewProblem makes problem details of e.
+// A service error keeps its errcode, errmsg, status, type and detail.
+// Any other error is regarded as an internal error, it becomes a generic 500 problem with a new error uuid,
+// and its message and stack are never put into the problem.
+func NewProblem(e error) Problem {
+	if se, ok := IsServiceErr(e); ok {
+		status := se.Status
+		if status == 0 {
+			status = DefaultServiceErrorStatus
+		}
+		typ := se.Type
+		if typ == "" {
+			typ = "about:blank"
+		}
+		return Problem{
+			Type:    typ,
+			Title:   se.Errmsg,
+			Status:  status,
+			Detail:  se.Detail,
+			Errcode: se.Errcode,
+			Errmsg:  se.Errmsg,
+		}
+	}
+
+	u, _ := NewV4()
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(http.StatusInternalServerError),
+		Status:    http.StatusInternalServerError,
+		ErrorUUID: u.String(),
+	}
+}
+
+// WriteProblem writes e as an application/problem+json response and returns the problem written.
+// Use the returned ErrorUUID to record an internal error, the client only gets the uuid.
+func WriteProblem(w http.ResponseWriter, r *http.Request, e error) Problem {
+	p := NewProblem(e)
+	writeProblem(w, r, &p)
+	return p
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if r != nil && r.URL != nil {
+		p.Instance = r.URL.RequestURI()
+	}
+
+	buf, er := json.Marshal(p)
+	if er != nil {
+		buf = []byte(`{"type":"about:blank","title":"Internal Server Error","status":500}`)
+		p.Status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(p.Status)
+	w.Write(buf)
+}
+
+// ProblemHandler is an http.Handler whose func returns an error.
+// A non-nil error is written by WriteProblem, an internal error is printed by DefaultHandler with its error uuid.
+//
+//	http.Handle("/pay", errorx.ProblemHandler(func(w http.ResponseWriter, r *http.Request) error {
+//	    if e := Pay(); e != nil {
+//	        return errorx.Wrap(e)
+//	    }
+//	    w.Write([]byte("ok"))
+//	    return nil
+//	}))
+type ProblemHandler func(w http.ResponseWriter, r *http.Request) error
+
+func (f ProblemHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e := f(w, r)
+	if e == nil {
+		return
+	}
+
+	p := WriteProblem(w, r, e)
+	if p.ErrorUUID != "" {
+		DefaultHandler(e, map[string]interface{}{
+			"error_uuid": p.ErrorUUID,
+			"instance":   p.Instance,
+		})
+	}
+}
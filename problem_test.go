@@ -0,0 +1,80 @@
+package errorx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProblemHandler(t *testing.T) {
+	balanceLack := NewServiceError("balance not enough", 10001).
+		WithStatus(http.StatusPaymentRequired).
+		WithType("https://example.com/problems/balance")
+
+	h := ProblemHandler(func(w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Query().Get("known") == "1" {
+			return Wrap(balanceLack.WithDetail("balance 10, cost 30"))
+		}
+		return Wrap(errors.New("connect to mysql time out"))
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/pay?known=1", nil))
+
+	var p Problem
+	if e := json.Unmarshal(w.Body.Bytes(), &p); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	if w.Code != http.StatusPaymentRequired || w.Header().Get("Content-Type") != ContentTypeProblem {
+		fmt.Println(w.Code, w.Header())
+		t.Fail()
+		return
+	}
+	if p.Errcode != 10001 || p.Title != "balance not enough" || p.Detail != "balance 10, cost 30" ||
+		p.Type != "https://example.com/problems/balance" || p.Instance != "/pay?known=1" {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/pay", nil))
+	p = Problem{}
+	if e := json.Unmarshal(w.Body.Bytes(), &p); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	if w.Code != http.StatusInternalServerError || p.ErrorUUID == "" || p.Errcode != 0 {
+		fmt.Println(w.Body.String())
+		t.Fail()
+		return
+	}
+	if strings.Contains(w.Body.String(), "mysql") || strings.Contains(w.Body.String(), ".go") {
+		fmt.Println("internal error leaks:", w.Body.String())
+		t.Fail()
+		return
+	}
+}
+
+func TestServiceErrorIs(t *testing.T) {
+	balanceLack := NewServiceError("balance not enough", 10001)
+	e := Wrap(balanceLack.WithStatus(http.StatusPaymentRequired).WithDetail("balance 10"))
+
+	if !errors.Is(e, balanceLack) {
+		t.Fail()
+		return
+	}
+	se, ok := IsServiceErr(e)
+	if !ok || se.Status != http.StatusPaymentRequired || se.Detail != "balance 10" {
+		fmt.Println(se, ok)
+		t.Fail()
+		return
+	}
+}
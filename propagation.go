@@ -0,0 +1,157 @@
+package errorx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// HeaderError carries an Error in schema of JSONVersion, base64 url encoded.
+	HeaderError = "X-Errorx-Error"
+	// HeaderService carries the name of the service where the error happens.
+	HeaderService = "X-Errorx-Service"
+	// HeaderErrcode carries errcode of a service error, for human reading only.
+	HeaderErrcode = "X-Errorx-Errcode"
+)
+
+// Envelope is the body form of an error passed between services.
+// Use it instead of headers when the error is too big for a header line.
+type Envelope struct {
+	Service string `json:"service"`
+	Error   *Error `json:"errorx"`
+}
+
+// EncodeHTTPHeader writes e into response header h, so the client can rebuild it by DecodeHTTPHeader.
+// service is the name of the current service, it's used to mark stack lines on the client side.
+//
+//	func Handler(w http.ResponseWriter, r *http.Request) {
+//	    if e := Service(); e != nil {
+//	        errorx.EncodeHTTPHeader(w.Header(), "user-service", e)
+//	        w.WriteHeader(500)
+//	        return
+//	    }
+//	}
+func EncodeHTTPHeader(h http.Header, service string, e error) error {
+	if e == nil {
+		return nil
+	}
+
+	er := MustWrap(e)
+	buf, err := json.Marshal(er)
+	if err != nil {
+		return Wrap(err)
+	}
+
+	h.Set(HeaderError, base64.RawURLEncoding.EncodeToString(buf))
+	h.Set(HeaderService, service)
+	if er.isServiceErr {
+		h.Set(HeaderErrcode, strconv.Itoa(er.serviceErrcode))
+	}
+	return nil
+}
+
+// DecodeHTTPHeader rebuilds the error written by EncodeHTTPHeader into a chained Error.
+// The remote stack lines are kept after a new line of the caller, and marked as '[remote service]'.
+// The remote error is the origin error of the returned one, so errors.As and IsServiceErr can reach it.
+// ok is false when h carries no error.
+//
+//	resp, e := http.Get("http://user-service/user/1")
+//	if re, ok := errorx.DecodeHTTPHeader(resp.Header); ok {
+//	    return re
+//	}
+func DecodeHTTPHeader(h http.Header) (Error, bool) {
+	value := h.Get(HeaderError)
+	if value == "" {
+		return Empty(), false
+	}
+
+	buf, e := base64.RawURLEncoding.DecodeString(value)
+	if e != nil {
+		rs := chainRemote(h.Get(HeaderService), Empty())
+		rs.wrapStackLine(fmt.Sprintf("decode header '%s' fail, err=%s", HeaderError, e.Error()))
+		return rs, true
+	}
+
+	var remote Error
+	if e := json.Unmarshal(buf, &remote); e != nil {
+		rs := chainRemote(h.Get(HeaderService), Empty())
+		rs.wrapStackLine(fmt.Sprintf("decode header '%s' fail, err=%s", HeaderError, e.Error()))
+		return rs, true
+	}
+
+	rs := chainRemote(h.Get(HeaderService), remote)
+	rs.wrapStackLine(remote.Message())
+	return rs, true
+}
+
+// EncodeEnvelope marshals e into the body form of Envelope.
+func EncodeEnvelope(service string, e error) ([]byte, error) {
+	if e == nil {
+		return nil, nil
+	}
+
+	er := MustWrap(e)
+	buf, err := json.Marshal(Envelope{
+		Service: service,
+		Error:   &er,
+	})
+	if err != nil {
+		return nil, Wrap(err)
+	}
+	return buf, nil
+}
+
+// DecodeEnvelope rebuilds the error marshalled by EncodeEnvelope into a chained Error, like DecodeHTTPHeader.
+func DecodeEnvelope(buf []byte) (Error, error) {
+	var tmp Envelope
+	if e := json.Unmarshal(buf, &tmp); e != nil {
+		return Empty(), Wrap(e)
+	}
+	if tmp.Error == nil {
+		return Empty(), NewFromString("field 'errorx' not found in envelope")
+	}
+
+	rs := chainRemote(tmp.Service, *tmp.Error)
+	rs.wrapStackLine(tmp.Error.Message())
+	return rs, nil
+}
+
+// chainRemote makes a local Error whose origin is remote.
+// Stack lines of remote are moved and marked with service, lines already marked by a further service keep their mark.
+// The cause keeps no stack lines, so they're encoded once when passed on, rather than once more by each hop.
+func chainRemote(service string, remote Error) Error {
+	rs := empty()
+	cause := remote
+	if cause.E == nil {
+		// Message() falls back to the last stack line, keep it before the lines are dropped
+		if msg := remote.Message(); msg != "" {
+			cause.E = fmt.Errorf("%s", msg)
+		}
+	}
+	cause.stackTracesV2 = nil
+	rs.E = cause
+	rs.isServiceErr = remote.isServiceErr
+	rs.serviceErrcode = remote.serviceErrcode
+	rs.serviceErrmsg = remote.serviceErrmsg
+
+	if len(remote.Header) != 0 {
+		rs.Header = make(map[string][]string, len(remote.Header))
+		for k, v := range remote.Header {
+			rs.Header[k] = append([]string(nil), v...)
+		}
+	}
+
+	for _, v := range remote.stackTracesV2 {
+		if v.remote == "" {
+			v.remote = service
+			if v.remote == "" {
+				v.remote = "unknown"
+			}
+		}
+		rs.stackTracesV2 = append(rs.stackTracesV2, v)
+	}
+	return rs
+}
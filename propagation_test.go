@@ -0,0 +1,125 @@
+package errorx
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHeaderPropagation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := WrapContext(NewServiceError("user not found", 10404), map[string]interface{}{
+			"user_id": 1,
+		})
+		if er := EncodeHTTPHeader(w.Header(), "user-service", e); er != nil {
+			fmt.Println(er.Error())
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	resp, e := http.Get(server.URL)
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	defer resp.Body.Close()
+
+	re, ok := DecodeHTTPHeader(resp.Header)
+	if !ok {
+		t.Fail()
+		return
+	}
+	fmt.Println(re.Error())
+
+	stack := re.Stack()
+	if len(stack) != 2 || strings.HasPrefix(stack[0], "[remote") || !strings.HasPrefix(stack[1], "[remote user-service]") {
+		fmt.Println(stack)
+		t.Fail()
+		return
+	}
+	se, ok := IsServiceErr(Wrap(re))
+	if !ok || se.Errcode != 10404 {
+		fmt.Println(se, ok)
+		t.Fail()
+		return
+	}
+
+	if _, ok := DecodeHTTPHeader(http.Header{}); ok {
+		t.Fail()
+		return
+	}
+}
+
+func TestEnvelopePropagation(t *testing.T) {
+	buf, e := EncodeEnvelope("order-service", Wrap(fmt.Errorf("nil return")))
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+
+	re, e := DecodeEnvelope(buf)
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	if re.Message() != "nil return" || !strings.HasPrefix(re.Stack()[1], "[remote order-service]") {
+		fmt.Println(re.Stack())
+		t.Fail()
+		return
+	}
+
+	// pass it to another service, lines keep their original mark
+	buf, _ = EncodeEnvelope("gateway", re)
+	re, _ = DecodeEnvelope(buf)
+	stack := re.Stack()
+	if !strings.HasPrefix(stack[1], "[remote gateway]") || !strings.HasPrefix(stack[2], "[remote order-service]") {
+		fmt.Println(stack)
+		t.Fail()
+		return
+	}
+
+	// stack lines are encoded once, however many hops the error passes
+	for i := 0; i < 5; i++ {
+		buf, _ = EncodeEnvelope(fmt.Sprintf("hop-%d", i), re)
+		if n := strings.Count(string(buf), `"desc"`); n != len(re.Stack()) {
+			fmt.Println(n, len(re.Stack()))
+			t.Fail()
+			return
+		}
+		re, _ = DecodeEnvelope(buf)
+	}
+	if re.Message() != "nil return" {
+		fmt.Println(re.Message())
+		t.Fail()
+		return
+	}
+}
+
+func TestEnvelopePropagationNoCause(t *testing.T) {
+	remote := empty()
+	remote.wrapStackLine("stock not enough")
+
+	buf, e := EncodeEnvelope("stock-service", remote)
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	re, e := DecodeEnvelope(buf)
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	if re.Message() != "stock not enough" {
+		fmt.Println(re.Message())
+		t.Fail()
+		return
+	}
+}
@@ -0,0 +1,284 @@
+package errorx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// RedactMask replaces redacted values unless the rule asks for a hash.
+const RedactMask = "***"
+
+// RedactRule tells which values are sensitive.
+// A value is redacted as a whole when its key is in Keys(case-insensitive) or matches KeyPattern.
+// Parts of string values matching ValuePattern are redacted, whatever their keys are.
+type RedactRule struct {
+	Keys         []string
+	KeyPattern   *regexp.Regexp
+	ValuePattern *regexp.Regexp
+
+	// replace values with 'sha256:' and the first 16 hex characters of their sha256 rather than '***',
+	// so the same values can still be correlated. It's not meant to keep values of low entropy like phone numbers secret.
+	Hash bool
+}
+
+// Redactor redacts sensitive values in context, header, attrs and stack descriptions before errors are reported.
+// A nil Redactor redacts nothing.
+//
+//	rp.SetRedactor(errorx.NewRedactor(
+//	    errorx.RedactRule{Keys: []string{"password", "token"}},
+//	    errorx.RedactRule{ValuePattern: regexp.MustCompile(`1[3-9]\d{9}`), Hash: true},
+//	))
+type Redactor struct {
+	rules []RedactRule
+	keys  []map[string]bool
+}
+
+func NewRedactor(rules ...RedactRule) *Redactor {
+	rd := &Redactor{
+		rules: rules,
+		keys:  make([]map[string]bool, len(rules)),
+	}
+	for i, v := range rules {
+		rd.keys[i] = make(map[string]bool, len(v.Keys))
+		for _, k := range v.Keys {
+			rd.keys[i][strings.ToLower(k)] = true
+		}
+	}
+	return rd
+}
+
+// Redact returns value redacted by rules, key is the name of value.
+func (rd *Redactor) Redact(key string, value interface{}) interface{} {
+	if rd == nil {
+		return value
+	}
+	if rule, ok := rd.matchKey(key); ok {
+		return rule.replace(fmt.Sprintf("%v", value))
+	}
+
+	switch v := value.(type) {
+	case string:
+		return rd.RedactString(v)
+	case []string:
+		var rs = make([]string, 0, len(v))
+		for _, s := range v {
+			rs = append(rs, rd.RedactString(s))
+		}
+		return rs
+	case map[string]interface{}:
+		return rd.RedactMap(v)
+	case map[string]string:
+		var rs = make(map[string]string, len(v))
+		for k, s := range v {
+			rs[k] = fmt.Sprintf("%v", rd.Redact(k, s))
+		}
+		return rs
+	case nil:
+		return value
+	}
+	// numbers like phone numbers are redacted as strings
+	if s := fmt.Sprintf("%v", value); rd.hasValuePattern() {
+		if rs := rd.RedactString(s); rs != s {
+			return rs
+		}
+	}
+	return value
+}
+
+func (rd *Redactor) hasValuePattern() bool {
+	for _, v := range rd.rules {
+		if v.ValuePattern != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (rd *Redactor) matchKey(key string) (RedactRule, bool) {
+	lower := strings.ToLower(key)
+	for i, v := range rd.rules {
+		if rd.keys[i][lower] || (v.KeyPattern != nil && v.KeyPattern.MatchString(key)) {
+			return v, true
+		}
+	}
+	return RedactRule{}, false
+}
+
+// RedactString redacts parts of s matching value patterns.
+func (rd *Redactor) RedactString(s string) string {
+	if rd == nil {
+		return s
+	}
+	for _, v := range rd.rules {
+		if v.ValuePattern == nil {
+			continue
+		}
+		s = v.ValuePattern.ReplaceAllStringFunc(s, v.replace)
+	}
+	return s
+}
+
+// RedactMap returns a redacted copy of m, nested maps are redacted as well.
+func (rd *Redactor) RedactMap(m map[string]interface{}) map[string]interface{} {
+	if rd == nil || m == nil {
+		return m
+	}
+	var rs = make(map[string]interface{}, len(m))
+	for k, v := range m {
+		rs[k] = rd.Redact(k, v)
+	}
+	return rs
+}
+
+// RedactHeader returns a redacted copy of header.
+func (rd *Redactor) RedactHeader(header map[string][]string) map[string][]string {
+	if rd == nil || header == nil {
+		return header
+	}
+	var rs = make(map[string][]string, len(header))
+	for k, v := range header {
+		rule, ok := rd.matchKey(k)
+		values := make([]string, 0, len(v))
+		for _, s := range v {
+			if ok {
+				values = append(values, rule.replace(s))
+				continue
+			}
+			values = append(values, rd.RedactString(s))
+		}
+		rs[k] = values
+	}
+	return rs
+}
+
+// RedactError returns a copy of e with its header, context, attrs and stack descriptions redacted,
+// and its origin error and errors in 'Errors' as well.
+// When the message of an official origin error changes, it's replaced by the redacted message, which still unwraps to it.
+func (rd *Redactor) RedactError(e Error) Error {
+	if rd == nil {
+		return e
+	}
+
+	e.Header = rd.RedactHeader(e.Header)
+	e.Context = rd.RedactMap(e.Context)
+
+	lines := make([]stackline, 0, len(e.stackTracesV2))
+	for _, v := range e.stackTracesV2 {
+		if len(v.attrs) != 0 {
+			attrs := make([]Attr, 0, len(v.attrs))
+			for _, a := range v.attrs {
+				ra := rd.redactAttr(a)
+				// WrapContext describes attrs as 'key=value', which value patterns alone miss when only the key is sensitive
+				if pair, redacted := a.pair(), ra.pair(); pair != redacted {
+					v.desc = strings.ReplaceAll(v.desc, pair, redacted)
+				}
+				attrs = append(attrs, ra)
+			}
+			v.attrs = attrs
+		}
+		v.desc = rd.RedactString(v.desc)
+		lines = append(lines, v)
+	}
+	e.stackTracesV2 = lines
+
+	e.E = rd.redactOrigin(e.E)
+	if len(e.Errors) != 0 {
+		es := make([]error, 0, len(e.Errors))
+		for _, v := range e.Errors {
+			es = append(es, rd.redactOrigin(v))
+		}
+		e.Errors = es
+	}
+	return e
+}
+
+// redactOrigin redacts an error saved in 'E' or 'Errors'.
+func (rd *Redactor) redactOrigin(err error) error {
+	switch v := err.(type) {
+	case nil, ServiceError:
+	case Error:
+		return rd.RedactError(v)
+	default:
+		if msg := rd.RedactString(v.Error()); msg != v.Error() {
+			return redactedError{msg: msg, err: v}
+		}
+	}
+	return err
+}
+
+func (rd *Redactor) redactAttr(a Attr) Attr {
+	v := rd.Redact(a.Key, a.Value)
+	if s, ok := v.(string); ok && a.Kind != KindString && a.Kind != KindAny {
+		// a redacted number or time becomes a string
+		return String(a.Key, s)
+	}
+	a.Value = v
+	return a
+}
+
+func (r RedactRule) replace(s string) string {
+	if !r.Hash {
+		return RedactMask
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:])[:16]
+}
+
+// redactedError hides the message of err, and still unwraps to it.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e redactedError) Error() string {
+	return e.msg
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
+
+type redactorValue struct {
+	rd *Redactor
+}
+
+var defaultRedactor atomic.Value
+
+// SetRedactor sets the redactor of package-level JSON, JSONIndent, WrapContext and NewWithParam,
+// and of Reporters without their own redactor. nil removes it.
+func SetRedactor(rd *Redactor) {
+	defaultRedactor.Store(redactorValue{rd: rd})
+}
+
+func currentRedactor() *Redactor {
+	v, _ := defaultRedactor.Load().(redactorValue)
+	return v.rd
+}
+
+// SetRedactor sets the redactor of r, context and errors are redacted by it in SaveError, JSON and JSONIndent,
+// so handlers like ReportURLHandler never see sensitive values. nil falls back to the package-level one, see SetRedactor.
+func (r *Reporter) SetRedactor(rd *Redactor) *Reporter {
+	if r.shared == nil {
+		r.shared = &reporterShared{}
+	}
+	r.shared.l.Lock()
+	defer r.shared.l.Unlock()
+	r.shared.redactor = rd
+	return r
+}
+
+func (r *Reporter) redactor() *Redactor {
+	if r.shared != nil {
+		r.shared.l.RLock()
+		rd := r.shared.redactor
+		r.shared.l.RUnlock()
+		if rd != nil {
+			return rd
+		}
+	}
+	return currentRedactor()
+}
@@ -0,0 +1,143 @@
+package errorx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func testRedactor() *Redactor {
+	return NewRedactor(
+		RedactRule{Keys: []string{"Password"}, KeyPattern: regexp.MustCompile(`(?i)token`)},
+		RedactRule{ValuePattern: regexp.MustCompile(`1[3-9]\d{9}`), Hash: true},
+	)
+}
+
+func TestRedactor(t *testing.T) {
+	rd := testRedactor()
+	rs := rd.RedactMap(map[string]interface{}{
+		"password":     "123456",
+		"access_token": "abc",
+		"phone":        13800000000,
+		"msg":          "call 13800000000 please",
+		"user":         map[string]interface{}{"PASSWORD": "123"},
+		"user_id":      1,
+	})
+	if rs["password"] != RedactMask || rs["access_token"] != RedactMask || rs["user_id"] != 1 ||
+		rs["user"].(map[string]interface{})["PASSWORD"] != RedactMask {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+	phone := rs["phone"].(string)
+	if !strings.HasPrefix(phone, "sha256:") || rs["msg"] != "call "+phone+" please" {
+		fmt.Println(rs)
+		t.Fail()
+		return
+	}
+
+	var nilRedactor *Redactor
+	if nilRedactor.RedactString("13800000000") != "13800000000" {
+		t.Fail()
+		return
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	rd := testRedactor()
+	origin := errors.New("user 13800000000 not found")
+	e := WrapAttrs(origin, String("token", "abc"), Int64("phone", 13800000000)).(Error)
+	e.SetHeader("password", "123456")
+
+	rs := rd.RedactError(e)
+	if strings.Contains(rs.Error(), "13800000000") || strings.Contains(rs.Error(), "123456") || strings.Contains(rs.Error(), "abc") {
+		fmt.Println(rs.Error())
+		t.Fail()
+		return
+	}
+	if !errors.Is(rs, origin) || e.GetHeader("password") != "123456" {
+		t.Fail()
+		return
+	}
+	buf, _ := json.Marshal(rs)
+	if strings.Contains(string(buf), "13800000000") {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+}
+
+func TestReporterRedact(t *testing.T) {
+	var (
+		saved   error
+		context map[string]interface{}
+	)
+	rp := NewReporter("test")
+	rp.AddModeHandler("test", func(e error, ctx map[string]interface{}) {
+		saved = e
+		context = ctx
+	})
+	rp.SetRedactor(testRedactor())
+
+	ctx := map[string]interface{}{"password": "123456"}
+	rp.Mode("test").SaveError(NewFromString("login fail"), ctx)
+	if context["password"] != RedactMask || ctx["password"] != "123456" || saved == nil {
+		fmt.Println(context)
+		t.Fail()
+		return
+	}
+
+	_, buf, _ := rp.JSON(NewFromString("login fail"), ctx)
+	if strings.Contains(string(buf), "123456") {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+}
+
+func TestSetRedactor(t *testing.T) {
+	SetRedactor(testRedactor())
+	defer SetRedactor(nil)
+
+	e := WrapContext(errors.New("login fail"), map[string]interface{}{"password": "123456"})
+	e2 := NewWithParam(errors.New("login fail"), "13800000000")
+	_, buf, _ := JSON(NewFromString("login fail"), map[string]interface{}{"token": "abc"})
+	if strings.Contains(e.Error(), "123456") || strings.Contains(e2.Error(), "13800000000") || strings.Contains(string(buf), "abc") {
+		fmt.Println(e.Error(), e2.Error(), string(buf))
+		t.Fail()
+		return
+	}
+}
+
+func TestReporterRedactWrapContext(t *testing.T) {
+	var saved error
+	rp := NewReporter("test")
+	rp.AddModeHandler("test", func(e error, ctx map[string]interface{}) {
+		saved = e
+	})
+	rp.SetRedactor(testRedactor())
+
+	// values of keys wrapped before the redactor sees them should be hidden in the description as well as attrs
+	e := WrapContext(fmt.Errorf("login fail"), map[string]interface{}{"password": "hunter2", "user_id": 1})
+	rp.Mode("test").SaveError(e, nil)
+	if saved == nil || strings.Contains(saved.Error(), "hunter2") || !strings.Contains(saved.Error(), "password="+RedactMask) ||
+		!strings.Contains(saved.Error(), "user_id=1") {
+		fmt.Println(saved)
+		t.Fail()
+		return
+	}
+
+	_, buf, _ := rp.JSON(e, nil)
+	if strings.Contains(string(buf), "hunter2") {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+	if !strings.Contains(e.Error(), "hunter2") {
+		t.Fail()
+		return
+	}
+}
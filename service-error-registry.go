@@ -0,0 +1,188 @@
+package errorx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CatalogEntry is a registered service error in catalog.
+type CatalogEntry struct {
+	// namespaced name, like 'payment.balance_not_enough'
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Errcode   int    `json:"errcode"`
+	Errmsg    string `json:"errmsg"`
+	Status    int    `json:"status,omitempty"`
+	Type      string `json:"type,omitempty"`
+}
+
+func (c CatalogEntry) serviceError() ServiceError {
+	return ServiceError{
+		Errcode: c.Errcode,
+		Errmsg:  c.Errmsg,
+		Status:  c.Status,
+		Type:    c.Type,
+	}
+}
+
+// Registry keeps service errors by errcode and by namespaced name.
+// It refuses a duplicate errcode or name, to stop two packages declaring the same errcode.
+//
+//	var BalanceLackErr = errorx.MustRegister("payment.balance_not_enough", "balance not enough", 10001)
+type Registry struct {
+	l      sync.RWMutex
+	byCode map[int]CatalogEntry
+	byName map[string]CatalogEntry
+}
+
+// DefaultRegistry is used by package level Register, MustRegister, Lookup, LookupName and Catalog.
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byCode: make(map[int]CatalogEntry, 0),
+		byName: make(map[string]CatalogEntry, 0),
+	}
+}
+
+// Register a service error by a namespaced name.
+// It returns an error when name is empty, or name or errcode has been registered.
+func (r *Registry) Register(name string, se ServiceError) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("errorx: register errcode %d with empty name", se.Errcode)
+	}
+
+	var namespace string
+	if i := strings.LastIndex(name, "."); i != -1 {
+		namespace = name[:i]
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if old, ok := r.byCode[se.Errcode]; ok {
+		return fmt.Errorf("errorx: register '%s' fail, errcode %d has been registered by '%s'", name, se.Errcode, old.Name)
+	}
+	if old, ok := r.byName[name]; ok {
+		return fmt.Errorf("errorx: register errcode %d fail, name '%s' has been registered by errcode %d", se.Errcode, name, old.Errcode)
+	}
+
+	entry := CatalogEntry{
+		Name:      name,
+		Namespace: namespace,
+		Errcode:   se.Errcode,
+		Errmsg:    se.Errmsg,
+		Status:    se.Status,
+		Type:      se.Type,
+	}
+	r.byCode[se.Errcode] = entry
+	r.byName[name] = entry
+	return nil
+}
+
+// MustRegister news a service error and registers it, it panics on duplicate errcode or name.
+// It's designed to be used in package level var declarations, so collision panics at init time.
+func (r *Registry) MustRegister(name string, errmsg string, errcode int) ServiceError {
+	se := NewServiceError(errmsg, errcode)
+	if e := r.Register(name, se); e != nil {
+		panic(e)
+	}
+	return se
+}
+
+// Lookup finds a registered service error by errcode.
+func (r *Registry) Lookup(errcode int) (ServiceError, bool) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	entry, ok := r.byCode[errcode]
+	if !ok {
+		return ServiceError{}, false
+	}
+	return entry.serviceError(), true
+}
+
+// LookupName finds a registered service error by namespaced name.
+func (r *Registry) LookupName(name string) (ServiceError, bool) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	entry, ok := r.byName[name]
+	if !ok {
+		return ServiceError{}, false
+	}
+	return entry.serviceError(), true
+}
+
+// Catalog returns all registered service errors ordered by errcode.
+func (r *Registry) Catalog() []CatalogEntry {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	var rs = make([]CatalogEntry, 0, len(r.byCode))
+	for _, v := range r.byCode {
+		rs = append(rs, v)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Errcode < rs[j].Errcode
+	})
+	return rs
+}
+
+// CatalogJSON exports catalog as a json array.
+func (r *Registry) CatalogJSON() ([]byte, error) {
+	buf, e := json.MarshalIndent(r.Catalog(), "", "  ")
+	if e != nil {
+		return nil, Wrap(e)
+	}
+	return buf, nil
+}
+
+// CatalogMarkdown exports catalog as a markdown table, which can be handed to client teams as an errcode document.
+func (r *Registry) CatalogMarkdown() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("| errcode | name | errmsg | status |\n")
+	buf.WriteString("| --- | --- | --- | --- |\n")
+	for _, v := range r.Catalog() {
+		var status string
+		if v.Status != 0 {
+			status = strconv.Itoa(v.Status)
+		}
+		fmt.Fprintf(&buf, "| %d | %s | %s | %s |\n", v.Errcode, markdownEscape(v.Name), markdownEscape(v.Errmsg), status)
+	}
+	return buf.Bytes()
+}
+
+func markdownEscape(s string) string {
+	s = strings.Replace(s, "|", "\\|", -1)
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+// Register a service error into DefaultRegistry.
+func Register(name string, se ServiceError) error {
+	return DefaultRegistry.Register(name, se)
+}
+
+// MustRegister news a service error and registers it into DefaultRegistry, it panics on duplicate errcode or name.
+func MustRegister(name string, errmsg string, errcode int) ServiceError {
+	return DefaultRegistry.MustRegister(name, errmsg, errcode)
+}
+
+// Lookup finds a service error in DefaultRegistry by errcode.
+func Lookup(errcode int) (ServiceError, bool) {
+	return DefaultRegistry.Lookup(errcode)
+}
+
+// LookupName finds a service error in DefaultRegistry by namespaced name.
+func LookupName(name string) (ServiceError, bool) {
+	return DefaultRegistry.LookupName(name)
+}
+
+// Catalog returns service errors registered in DefaultRegistry ordered by errcode.
+func Catalog() []CatalogEntry {
+	return DefaultRegistry.Catalog()
+}
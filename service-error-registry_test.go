@@ -0,0 +1,74 @@
+package errorx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	balanceLack := r.MustRegister("payment.balance_not_enough", "balance not enough", 10001)
+	r.MustRegister("user.not_found", "user not found", 10404)
+
+	if e := r.Register("order.balance_not_enough", NewServiceError("balance lack", 10001)); e == nil {
+		fmt.Println("duplicate errcode should be refused")
+		t.Fail()
+		return
+	}
+	if e := r.Register("user.not_found", NewServiceError("user not exist", 10405)); e == nil {
+		fmt.Println("duplicate name should be refused")
+		t.Fail()
+		return
+	}
+
+	se, ok := r.Lookup(10001)
+	if !ok || !se.Equal(balanceLack) {
+		fmt.Println(se, ok)
+		t.Fail()
+		return
+	}
+	if se, ok := r.LookupName("user.not_found"); !ok || se.Errcode != 10404 {
+		fmt.Println(se, ok)
+		t.Fail()
+		return
+	}
+	if _, ok := r.Lookup(10405); ok {
+		t.Fail()
+		return
+	}
+
+	buf, e := r.CatalogJSON()
+	if e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	var catalog []CatalogEntry
+	if e := json.Unmarshal(buf, &catalog); e != nil || len(catalog) != 2 || catalog[0].Errcode != 10001 || catalog[0].Namespace != "payment" {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+
+	md := string(r.CatalogMarkdown())
+	fmt.Println(md)
+	if !strings.Contains(md, "| 10404 | user.not_found | user not found |  |") {
+		t.Fail()
+		return
+	}
+}
+
+func TestMustRegisterPanic(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister("payment.balance_not_enough", "balance not enough", 10001)
+
+	defer func() {
+		if p := recover(); p == nil {
+			fmt.Println("duplicate errcode should panic")
+			t.Fail()
+		}
+	}()
+	r.MustRegister("order.balance_not_enough", "balance not enough", 10001)
+}
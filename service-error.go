@@ -1,8 +1,15 @@
 package errorx
 
+import "errors"
+
 type ServiceError struct {
 	Errcode int
 	Errmsg  string
+
+	// optional, used when the error is written as an HTTP problem, see WriteProblem
+	Status int    // HTTP status code, DefaultServiceErrorStatus is used when 0
+	Type   string // URI reference identifying the problem type
+	Detail string // explanation specific to this occurrence
 }
 
 func (se ServiceError) Error() string {
@@ -13,6 +20,30 @@ func (se ServiceError) Equal(dest ServiceError) bool {
 	return se.Errmsg == dest.Errmsg && se.Errcode == dest.Errcode
 }
 
+// Is makes errors.Is match a service error by errcode and errmsg, regardless of Status, Type and Detail.
+func (se ServiceError) Is(target error) bool {
+	dest, ok := target.(ServiceError)
+	return ok && se.Equal(dest)
+}
+
+// WithStatus returns a copy of se with HTTP status.
+func (se ServiceError) WithStatus(status int) ServiceError {
+	se.Status = status
+	return se
+}
+
+// WithType returns a copy of se with a problem type URI.
+func (se ServiceError) WithType(uri string) ServiceError {
+	se.Type = uri
+	return se
+}
+
+// WithDetail returns a copy of se with detail of this occurrence.
+func (se ServiceError) WithDetail(detail string) ServiceError {
+	se.Detail = detail
+	return se
+}
+
 func NewServiceError(errmsg string, errcode int) ServiceError {
 	return ServiceError{
 		Errcode: errcode,
@@ -23,19 +54,27 @@ func NewServiceError(errmsg string, errcode int) ServiceError {
 // IsServiceErr is used to handle service error.
 //
 //	Case below will be regarded as service error and return se,true
+//
+// When dest is empty, src's whole unwrap chain is searched for a ServiceError, so a ServiceError wrapped by Wrap,
+// WrapContext or fmt.Errorf("%w") is found as well.
+// When dest is given, src matches a dest if errors.Is(src, dest) reports true.
 func IsServiceErr(src error, dest ...error) (ServiceError, bool) {
+	if src == nil {
+		return ServiceError{}, false
+	}
 	if len(dest) == 0 {
-		se, ok := src.(ServiceError)
-		if ok {
+		var se ServiceError
+		if errors.As(src, &se) {
 			return se, true
 		}
 
-		e, ok2 := src.(Error)
-		if ok2 && e.isServiceErr == true {
-			return ServiceError{
-				Errmsg:  e.serviceErrmsg,
-				Errcode: e.serviceErrcode,
-			}, true
+		for e := src; e != nil; e = errors.Unwrap(e) {
+			if v, ok := e.(Error); ok && v.isServiceErr == true {
+				return ServiceError{
+					Errmsg:  v.serviceErrmsg,
+					Errcode: v.serviceErrcode,
+				}, true
+			}
 		}
 
 		return ServiceError{}, false
@@ -54,38 +93,12 @@ func isServiceErr(src error, dest error) (ServiceError, bool) {
 	if dest == nil {
 		return ServiceError{}, false
 	}
-	destS, ok := dest.(ServiceError)
-
-	if src.Error() == dest.Error() && !ok {
-		return NewServiceError(src.Error(), 0), true
-	}
-	if src.Error() == dest.Error() && ok {
-		return destS, true
-	}
-
-	if !ok {
-		if isBasicErr(dest) {
-			return isServiceErr(src, NewServiceError(dest.Error(), 0))
-		}
+	if !errors.Is(src, dest) {
 		return ServiceError{}, false
 	}
 
-	switch v := src.(type) {
-	case ServiceError:
-		if v.Equal(destS) {
-			return destS, true
-		}
-		return v, false
-	case Error:
-		if v.E == nil {
-			return ServiceError{}, false
-		}
-		if v.E.Error() == dest.Error() {
-			return destS, true
-		}
-		return ServiceError{}, false
-	case error:
-		return ServiceError{}, false
+	if destS, ok := dest.(ServiceError); ok {
+		return destS, true
 	}
-	return ServiceError{}, false
+	return NewServiceError(dest.Error(), 0), true
 }
@@ -0,0 +1,189 @@
+package errorx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileSinkOption configures a FileSink.
+type FileSinkOption struct {
+	Path string
+	// the file is rotated when it's going to exceed MaxSize bytes, default 100MB, negative never rotates
+	MaxSize int64
+	// number of rotated files kept as Path.1, Path.2 ..., Path.1 is the latest, default 5
+	MaxBackups int
+	// buffered reports are written out within FlushInterval, default 1s, negative writes each report out at once
+	FlushInterval time.Duration
+}
+
+// FileSink writes reports into a file as json lines, and rotates it by size.
+// Writes are buffered and flushed within FlushInterval, call Flush or Reporter.Flush to write them out at once.
+// When rotation fails, reports are still appended to Path.
+type FileSink struct {
+	opt FileSinkOption
+
+	l    sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	size int64
+	// pending flush of buffered reports
+	timer *time.Timer
+}
+
+// NewFileSink opens, or creates, the file at opt.Path to append reports.
+func NewFileSink(opt FileSinkOption) (*FileSink, error) {
+	if opt.Path == "" {
+		return nil, fmt.Errorf("errorx: file sink path empty")
+	}
+	if opt.MaxSize == 0 {
+		opt.MaxSize = 100 << 20
+	}
+	if opt.MaxBackups <= 0 {
+		opt.MaxBackups = 5
+	}
+	if opt.FlushInterval == 0 {
+		opt.FlushInterval = time.Second
+	}
+	s := &FileSink{opt: opt}
+	if er := s.open(); er != nil {
+		return nil, er
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	if er := os.MkdirAll(filepath.Dir(s.opt.Path), 0755); er != nil {
+		return Wrap(er)
+	}
+	f, er := os.OpenFile(s.opt.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if er != nil {
+		return Wrap(er)
+	}
+	info, er := f.Stat()
+	if er != nil {
+		f.Close()
+		return Wrap(er)
+	}
+	s.f = f
+	s.w = bufio.NewWriter(f)
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(ctx context.Context, r Report) error {
+	buf, er := json.Marshal(r)
+	if er != nil {
+		return er
+	}
+	buf = append(buf, '\n')
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.f == nil {
+		return fmt.Errorf("errorx: file sink '%s' closed", s.opt.Path)
+	}
+	var rotateErr error
+	if s.opt.MaxSize > 0 && s.size > 0 && s.size+int64(len(buf)) > s.opt.MaxSize {
+		// the report goes to Path anyway if the file is reopened
+		if rotateErr = s.rotate(); s.f == nil {
+			return rotateErr
+		}
+	}
+	n, er := s.w.Write(buf)
+	s.size += int64(n)
+	if er == nil {
+		er = s.flushLater()
+	}
+	if er == nil {
+		er = rotateErr
+	}
+	return er
+}
+
+// flushLater flushes buffered reports after FlushInterval, or at once if it's negative.
+func (s *FileSink) flushLater() error {
+	if s.opt.FlushInterval < 0 {
+		return Wrap(s.w.Flush())
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.opt.FlushInterval, func() {
+			s.l.Lock()
+			defer s.l.Unlock()
+			s.timer = nil
+			if s.f != nil {
+				s.w.Flush()
+			}
+		})
+	}
+	return nil
+}
+
+// rotate renames Path.i to Path.i+1, Path to Path.1, and opens a new file at Path.
+// If any step fails, Path is opened again, so later writes don't fail for the same reason.
+func (s *FileSink) rotate() error {
+	er := s.closeFile()
+	if er == nil {
+		er = s.shift()
+	}
+	if e := s.open(); e != nil {
+		return e
+	}
+	return er
+}
+
+// shift renames backups and Path to make room for a new file at Path.
+func (s *FileSink) shift() error {
+	os.Remove(s.backup(s.opt.MaxBackups))
+	for i := s.opt.MaxBackups - 1; i >= 1; i-- {
+		if er := os.Rename(s.backup(i), s.backup(i+1)); er != nil && !os.IsNotExist(er) {
+			return Wrap(er)
+		}
+	}
+	if er := os.Rename(s.opt.Path, s.backup(1)); er != nil {
+		return Wrap(er)
+	}
+	return nil
+}
+
+func (s *FileSink) backup(i int) string {
+	return fmt.Sprintf("%s.%d", s.opt.Path, i)
+}
+
+func (s *FileSink) closeFile() error {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	er := s.w.Flush()
+	if e := s.f.Close(); er == nil {
+		er = e
+	}
+	s.f = nil
+	s.w = nil
+	return Wrap(er)
+}
+
+func (s *FileSink) Flush(ctx context.Context) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	return Wrap(s.w.Flush())
+}
+
+// Close flushes and closes the file, writes after Close fail.
+func (s *FileSink) Close(ctx context.Context) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	return s.closeFile()
+}
@@ -0,0 +1,112 @@
+package errorx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// WebhookSinkOption configures a WebhookSink.
+type WebhookSinkOption struct {
+	URL string
+	// default POST
+	Method  string
+	Headers map[string]string
+	// a text/template rendering the body from a Report, the report marshalled as json by default.
+	// Besides fields of Report, func 'json' marshals a value, like:
+	//
+	//	{"msgtype": "text", "text": {"content": {{json .Error.Error}}}}
+	Template string
+	// default http.Client with Timeout
+	Client *http.Client
+	// default 15s
+	Timeout time.Duration
+}
+
+// WebhookSink sends each report to an url, like an IM robot or an alerting service.
+// A response without status 2xx is an error.
+type WebhookSink struct {
+	opt  WebhookSinkOption
+	tmpl *template.Template
+	c    *http.Client
+}
+
+// NewWebhookSink returns a WebhookSink, it fails when the url is empty or the template is invalid.
+func NewWebhookSink(opt WebhookSinkOption) (*WebhookSink, error) {
+	if opt.URL == "" {
+		return nil, fmt.Errorf("errorx: webhook sink url empty")
+	}
+	if opt.Method == "" {
+		opt.Method = http.MethodPost
+	}
+	if opt.Timeout == 0 {
+		opt.Timeout = 15 * time.Second
+	}
+	s := &WebhookSink{opt: opt, c: opt.Client}
+	if s.c == nil {
+		s.c = &http.Client{Timeout: opt.Timeout}
+	}
+	if opt.Template != "" {
+		tmpl, er := template.New("webhook").Funcs(template.FuncMap{
+			"json": webhookJSON,
+		}).Parse(opt.Template)
+		if er != nil {
+			return nil, fmt.Errorf("errorx: webhook sink template: %s", er.Error())
+		}
+		s.tmpl = tmpl
+	}
+	return s, nil
+}
+
+func webhookJSON(v interface{}) (string, error) {
+	buf, er := json.Marshal(v)
+	return string(buf), er
+}
+
+func (s *WebhookSink) Write(ctx context.Context, r Report) error {
+	var body bytes.Buffer
+	if s.tmpl != nil {
+		if er := s.tmpl.Execute(&body, r); er != nil {
+			return er
+		}
+	} else {
+		buf, er := json.Marshal(r)
+		if er != nil {
+			return er
+		}
+		body.Write(buf)
+	}
+
+	req, er := http.NewRequestWithContext(ctx, s.opt.Method, s.opt.URL, &body)
+	if er != nil {
+		return er
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.opt.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, er := s.c.Do(req)
+	if er != nil {
+		return er
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("errorx: webhook '%s' responds %d: %s", s.opt.URL, resp.StatusCode, buf)
+	}
+	return nil
+}
+
+func (s *WebhookSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *WebhookSink) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,279 @@
+package errorx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Report is an error saved by Reporter, written to sinks.
+type Report struct {
+	ErrorUUID string
+	Mode      string
+	Time      time.Time
+	Error     Error
+	Context   map[string]interface{}
+}
+
+// MarshalJSON implements json.Marshaler, in the same shape as what ReportURLHandler posts, with mode and time added.
+func (r Report) MarshalJSON() ([]byte, error) {
+	var tmp = make(map[string]interface{}, 0)
+	tmp["error_uuid"] = r.ErrorUUID
+	tmp["mode"] = r.Mode
+	tmp["time"] = r.Time.Format(time.RFC3339Nano)
+	tmp["message"] = r.Error.Error()
+	if attrs := r.Error.Attrs(); len(attrs) != 0 {
+		tmp["attrs"] = attrs
+	}
+	tmp["error"] = r.Error
+	tmp["context"] = jsonSafeContext(r.Context)
+	return json.Marshal(tmp)
+}
+
+// Sink receives reports of the modes it's added to, see Reporter.AddSink.
+// Write may buffer reports, Flush writes what's buffered out, Close flushes and releases the sink.
+type Sink interface {
+	Write(ctx context.Context, r Report) error
+	Flush(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// AddSink routes reports of mode to sinks as well, besides the handler added by AddModeHandler.
+// Reporter.Close flushes and closes sinks.
+//
+//	file, _ := errorx.NewFileSink(errorx.FileSinkOption{Path: "/var/log/errorx/errors.jsonl"})
+//	rp.AddSink("pro", file, errorx.NewStdoutSink(false))
+//	defer rp.Close(context.Background())
+func (r *Reporter) AddSink(mode string, sinks ...Sink) *Reporter {
+	if r.shared == nil {
+		r.shared = &reporterShared{}
+	}
+	r.shared.l.Lock()
+	defer r.shared.l.Unlock()
+	if r.shared.sinks == nil {
+		r.shared.sinks = make(map[string][]Sink, 0)
+	}
+	rs := append([]Sink(nil), r.shared.sinks[mode]...)
+	for _, v := range sinks {
+		if v != nil {
+			rs = append(rs, v)
+		}
+	}
+	r.shared.sinks[mode] = rs
+	return r
+}
+
+// Flush flushes sinks of all modes.
+func (r *Reporter) Flush(ctx context.Context) error {
+	var me MultiError
+	for _, v := range r.allSinks() {
+		me.Append(v.Flush(ctx))
+	}
+	return me.ErrorOrNil()
+}
+
+// sinks returns sinks of mode added by AddSink, and the config applied if it has sinks of mode.
+func (r *Reporter) sinks(mode string) ([]Sink, *reporterConfig) {
+	if r.shared == nil {
+		return nil, nil
+	}
+	r.shared.l.RLock()
+	defer r.shared.l.RUnlock()
+	rs := append([]Sink(nil), r.shared.sinks[mode]...)
+	rc := r.shared.config
+	if rc != nil && len(rc.sinks[mode]) == 0 {
+		rc = nil
+	}
+	return rs, rc
+}
+
+// allSinks returns sinks of all modes, each sink once.
+func (r *Reporter) allSinks() []Sink {
+	if r.shared == nil {
+		return nil
+	}
+	r.shared.l.RLock()
+	defer r.shared.l.RUnlock()
+
+	var (
+		rs   = make([]Sink, 0, 4)
+		seen = make(map[Sink]bool, 0)
+	)
+	add := func(m map[string][]Sink) {
+		for _, sinks := range m {
+			for _, v := range sinks {
+				// a sink added to several modes is flushed and closed once, sinks not comparable can't be added twice
+				if !reflect.TypeOf(v).Comparable() {
+					rs = append(rs, v)
+					continue
+				}
+				if !seen[v] {
+					seen[v] = true
+					rs = append(rs, v)
+				}
+			}
+		}
+	}
+	add(r.shared.sinks)
+	if r.shared.config != nil {
+		add(r.shared.config.sinks)
+	}
+	return rs
+}
+
+// sinkHandler writes reports to sinks and sinks of rc, then calls next if it's not nil.
+// When a sink fails, the error is printed by DefaultHandler with the reason in context 'reporter'.
+// Reports are written even if ctx is canceled, like a summary of deduplication sent after the request ends.
+// Sinks of rc are skipped once the config is replaced, since they're closed.
+func (r *Reporter) sinkHandler(ctx context.Context, sinks []Sink, rc *reporterConfig, next func(e error, context map[string]interface{})) func(e error, context map[string]interface{}) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithoutCancel(ctx)
+	mode := r.mode
+	m := r.metrics()
+
+	return func(e error, context map[string]interface{}) {
+		report := Report{
+			Mode:    mode,
+			Time:    time.Now(),
+			Error:   MustWrap(e),
+			Context: make(map[string]interface{}, len(context)),
+		}
+		for k, v := range context {
+			if k == "error_uuid" {
+				report.ErrorUUID, _ = v.(string)
+				continue
+			}
+			report.Context[k] = v
+		}
+
+		write := func(s Sink) {
+			if er := s.Write(ctx, report); er != nil {
+				m.Add("reporter_sink_failed", MetricLabels{Mode: mode, Handler: fmt.Sprintf("%T", s)}, 1)
+				tmp := make(map[string]interface{}, len(context)+1)
+				for k, v := range context {
+					tmp[k] = v
+				}
+				tmp["reporter"] = fmt.Sprintf("sink %T write fail, err=%s", s, er.Error())
+				DefaultHandler(e, tmp)
+			}
+		}
+		for _, v := range sinks {
+			write(v)
+		}
+		if rc != nil && rc.acquire() {
+			for _, v := range rc.sinks[mode] {
+				write(v)
+			}
+			rc.release()
+		}
+		if next != nil {
+			next(e, context)
+		}
+	}
+}
+
+// WriterSink writes reports to an io.Writer as json, one in a line, or indented.
+type WriterSink struct {
+	l      sync.Mutex
+	w      io.Writer
+	pretty bool
+}
+
+// NewWriterSink writes reports into w, indented if pretty is true, otherwise a report in a line.
+func NewWriterSink(w io.Writer, pretty bool) *WriterSink {
+	return &WriterSink{w: w, pretty: pretty}
+}
+
+// NewStdoutSink writes reports into stdout, see NewWriterSink.
+func NewStdoutSink(pretty bool) *WriterSink {
+	return NewWriterSink(os.Stdout, pretty)
+}
+
+func (s *WriterSink) Write(ctx context.Context, r Report) error {
+	var (
+		buf []byte
+		er  error
+	)
+	if s.pretty {
+		buf, er = json.MarshalIndent(r, "", "  ")
+	} else {
+		buf, er = json.Marshal(r)
+	}
+	if er != nil {
+		return er
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	_, er = s.w.Write(append(buf, '\n'))
+	return er
+}
+
+func (s *WriterSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *WriterSink) Close(ctx context.Context) error {
+	return nil
+}
+
+// MemorySink keeps the latest reports in memory, it suits tests.
+type MemorySink struct {
+	l       sync.Mutex
+	reports []Report
+	next    int
+	full    bool
+}
+
+// NewMemorySink keeps the latest size reports, default 100.
+func NewMemorySink(size int) *MemorySink {
+	if size <= 0 {
+		size = 100
+	}
+	return &MemorySink{reports: make([]Report, size)}
+}
+
+func (s *MemorySink) Write(ctx context.Context, r Report) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.reports[s.next] = r
+	s.next = (s.next + 1) % len(s.reports)
+	if s.next == 0 {
+		s.full = true
+	}
+	return nil
+}
+
+// Reports returns reports kept, the oldest first.
+func (s *MemorySink) Reports() []Report {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if !s.full {
+		return append([]Report(nil), s.reports[:s.next]...)
+	}
+	return append(append([]Report(nil), s.reports[s.next:]...), s.reports[:s.next]...)
+}
+
+// Reset drops reports kept.
+func (s *MemorySink) Reset() {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.reports = make([]Report, len(s.reports))
+	s.next = 0
+	s.full = false
+}
+
+func (s *MemorySink) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemorySink) Close(ctx context.Context) error {
+	return nil
+}
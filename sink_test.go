@@ -0,0 +1,325 @@
+package errorx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReporterSink(t *testing.T) {
+	var (
+		mem     = NewMemorySink(2)
+		buf     bytes.Buffer
+		handled int
+	)
+	rp := NewReporter("pro")
+	rp.AddModeHandler("pro", func(e error, context map[string]interface{}) {
+		handled++
+	})
+	rp.AddSink("pro", mem, NewWriterSink(&buf, false))
+
+	var uuids []string
+	for i := 0; i < 3; i++ {
+		uuids = append(uuids, rp.SaveErrorCtx(WithRequestID(context.Background(), "req-1"), errors.New("nil return"), map[string]interface{}{
+			"index": i,
+		}))
+	}
+
+	// handler of mode still works besides sinks
+	if handled != 3 {
+		fmt.Println(handled)
+		t.Fail()
+		return
+	}
+
+	reports := mem.Reports()
+	if len(reports) != 2 || reports[0].ErrorUUID != uuids[1] || reports[1].ErrorUUID != uuids[2] {
+		fmt.Println(reports)
+		t.Fail()
+		return
+	}
+	if reports[1].Mode != "pro" || reports[1].Context["index"] != 2 || reports[1].Context[FieldRequestID] != "req-1" {
+		fmt.Println(reports[1])
+		t.Fail()
+		return
+	}
+	if _, ok := reports[1].Context["error_uuid"]; ok {
+		fmt.Println(reports[1].Context)
+		t.Fail()
+		return
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		fmt.Println(buf.String())
+		t.Fail()
+		return
+	}
+	var tmp map[string]interface{}
+	if e := json.Unmarshal([]byte(lines[0]), &tmp); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	if tmp["error_uuid"] != uuids[0] || tmp["mode"] != "pro" || !strings.Contains(tmp["message"].(string), "nil return") {
+		fmt.Println(tmp)
+		t.Fail()
+		return
+	}
+
+	mem.Reset()
+	if len(mem.Reports()) != 0 {
+		t.Fail()
+		return
+	}
+	if e := rp.Close(context.Background()); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "errors.jsonl")
+	s, er := NewFileSink(FileSinkOption{Path: path, MaxSize: 1024, MaxBackups: 2})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	rp := NewReporter("pro")
+	rp.AddSink("pro", s)
+
+	for i := 0; i < 20; i++ {
+		rp.SaveError(NewFromStringf("connect to redis time out %d", i), nil)
+	}
+	if e := rp.Close(context.Background()); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+
+	// the current file and 2 backups are kept, each with complete lines
+	for _, v := range []string{path, path + ".1", path + ".2"} {
+		f, e := os.Open(v)
+		if e != nil {
+			fmt.Println(e.Error())
+			t.Fail()
+			return
+		}
+		info, _ := f.Stat()
+		if info.Size() > 1024 {
+			fmt.Println(v, info.Size())
+			t.Fail()
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var tmp map[string]interface{}
+			if e := json.Unmarshal(scanner.Bytes(), &tmp); e != nil {
+				fmt.Println(v, e.Error())
+				t.Fail()
+			}
+		}
+		f.Close()
+	}
+	if _, e := os.Stat(path + ".3"); !os.IsNotExist(e) {
+		t.Fail()
+		return
+	}
+
+	if e := s.Write(context.Background(), Report{Error: NewFromString("after close").(Error)}); e == nil {
+		t.Fail()
+		return
+	}
+}
+
+func TestFileSinkRotateFail(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "errors.jsonl")
+	// Path can't be renamed to Path.1, a directory not empty
+	os.MkdirAll(filepath.Join(path+".1", "x"), 0755)
+
+	s, er := NewFileSink(FileSinkOption{Path: path, MaxSize: 256, MaxBackups: 1, FlushInterval: -1})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	defer s.Close(context.Background())
+
+	failed := 0
+	for i := 0; i < 10; i++ {
+		if e := s.Write(context.Background(), Report{Error: NewFromStringf("connect to redis time out %d", i).(Error)}); e != nil {
+			failed++
+		}
+	}
+	buf, _ := ioutil.ReadFile(path)
+	if failed == 0 || strings.Count(string(buf), "\n") != 10 {
+		fmt.Println(failed, string(buf))
+		t.Fail()
+		return
+	}
+}
+
+func TestFileSinkFlushInterval(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "errors.jsonl")
+	s, er := NewFileSink(FileSinkOption{Path: path, FlushInterval: 50 * time.Millisecond})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	defer s.Close(context.Background())
+
+	s.Write(context.Background(), Report{Error: NewFromString("nil return").(Error)})
+	time.Sleep(200 * time.Millisecond)
+	if buf, _ := ioutil.ReadFile(path); !bytes.Contains(buf, []byte("nil return")) {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var (
+		header string
+		body   []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Token")
+		body, _ = ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	s, er := NewWebhookSink(WebhookSinkOption{
+		URL:      server.URL,
+		Headers:  map[string]string{"X-Token": "abc"},
+		Template: `{"msgtype": "text", "text": {"content": {{json .Error.Error}}}, "uuid": "{{.ErrorUUID}}"}`,
+	})
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	report := Report{ErrorUUID: "u-1", Error: NewFromString("nil \"return\"").(Error)}
+	if e := s.Write(context.Background(), report); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	var tmp struct {
+		Text struct {
+			Content string `json:"content"`
+		} `json:"text"`
+		UUID string `json:"uuid"`
+	}
+	if e := json.Unmarshal(body, &tmp); e != nil {
+		fmt.Println(string(body), e.Error())
+		t.Fail()
+		return
+	}
+	if header != "abc" || tmp.UUID != "u-1" || !strings.Contains(tmp.Text.Content, `nil "return"`) {
+		fmt.Println(header, string(body))
+		t.Fail()
+		return
+	}
+
+	s, _ = NewWebhookSink(WebhookSinkOption{URL: server.URL + "/fail"})
+	if e := s.Write(context.Background(), report); e == nil || !strings.Contains(e.Error(), "500") {
+		fmt.Println(e)
+		t.Fail()
+		return
+	}
+
+	if _, e := NewWebhookSink(WebhookSinkOption{URL: server.URL, Template: "{{.Error"}); e == nil {
+		t.Fail()
+		return
+	}
+}
+
+func TestConfigSinks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "errorx")
+	defer os.RemoveAll(dir)
+
+	c := Config{
+		Mode: "pro",
+		Sinks: map[string][]SinkConfig{
+			"pro": {{Type: "file", Path: filepath.Join(dir, "errors.jsonl")}},
+		},
+	}
+	rp, er := NewReporterFromConfig(c)
+	if er != nil {
+		fmt.Println(er.Error())
+		t.Fail()
+		return
+	}
+	rp.SaveError(NewFromString("nil return"), nil)
+	if e := rp.Flush(context.Background()); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	buf, _ := ioutil.ReadFile(filepath.Join(dir, "errors.jsonl"))
+	if !strings.Contains(string(buf), "nil return") {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+
+	// reloading closes sinks of the config before
+	c.Sinks["pro"][0].Path = filepath.Join(dir, "errors2.jsonl")
+	if e := rp.ApplyConfig(c); e != nil {
+		fmt.Println(e.Error())
+		t.Fail()
+		return
+	}
+	rp.SaveError(NewFromString("nil return again"), nil)
+	rp.Close(context.Background())
+	buf, _ = ioutil.ReadFile(filepath.Join(dir, "errors2.jsonl"))
+	if !strings.Contains(string(buf), "nil return again") {
+		fmt.Println(string(buf))
+		t.Fail()
+		return
+	}
+
+	bad := Config{
+		Mode: "pro",
+		Sinks: map[string][]SinkConfig{
+			"pro": {{Type: "file"}, {Type: "webhook", URL: "ftp://x"}, {Type: "kafka"}},
+		},
+	}
+	e := bad.Validate()
+	if e == nil {
+		t.Fail()
+		return
+	}
+	for _, v := range []string{"sinks.pro[0].path", "sinks.pro[1].url", "sinks.pro[2].type"} {
+		if !strings.Contains(e.Error(), v) {
+			fmt.Println(e.Error())
+			t.Fail()
+			return
+		}
+	}
+}
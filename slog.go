@@ -0,0 +1,287 @@
+package errorx
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+)
+
+// LogValue implements slog.LogValuer. An Error is logged as a group:
+//
+//	msg      root message
+//	errcode  errcode and errmsg, for a service error
+//	errmsg
+//	stack    stack lines as an array
+//	frames   the whole call stack as an array, see Lfullstack
+//	header   header values
+//	attrs    typed attrs, see Attrs
+//	context  context values
+func (e Error) LogValue() slog.Value {
+	var attrs = make([]slog.Attr, 0, 8)
+	attrs = append(attrs, slog.String("msg", e.Message()))
+
+	if se, ok := IsServiceErr(e); ok {
+		attrs = append(attrs, slog.Int("errcode", se.Errcode), slog.String("errmsg", se.Errmsg))
+	}
+
+	var stack = make([]string, 0, len(e.stackTracesV2))
+	for _, v := range e.stackTracesV2 {
+		stack = append(stack, v.String())
+	}
+	attrs = append(attrs, slog.Any("stack", stack))
+
+	if frames := e.StackFrames(); len(frames) != 0 {
+		attrs = append(attrs, slog.Any("frames", frames))
+	}
+
+	if len(e.Header) != 0 {
+		var header = make([]slog.Attr, 0, len(e.Header))
+		for _, k := range sortedKeys(e.Header) {
+			header = append(header, slog.String(k, e.GetHeader(k)))
+		}
+		attrs = append(attrs, slog.Attr{Key: "header", Value: slog.GroupValue(header...)})
+	}
+
+	if v := Attrs(e); len(v) != 0 {
+		var group = make([]slog.Attr, 0, len(v))
+		for _, a := range v {
+			group = append(group, a.slogAttr())
+		}
+		attrs = append(attrs, slog.Attr{Key: "attrs", Value: slog.GroupValue(group...)})
+	}
+
+	if len(e.Context) != 0 {
+		var group = make([]slog.Attr, 0, len(e.Context))
+		for _, a := range sortedAttrs(e.Context) {
+			group = append(group, a.slogAttr())
+		}
+		attrs = append(attrs, slog.Attr{Key: "context", Value: slog.GroupValue(group...)})
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// LogValue implements slog.LogValuer. A ServiceError is logged as a group of errcode, errmsg, and status, type,
+// detail if they are set.
+func (se ServiceError) LogValue() slog.Value {
+	var attrs = make([]slog.Attr, 0, 5)
+	attrs = append(attrs, slog.Int("errcode", se.Errcode), slog.String("errmsg", se.Errmsg))
+	if se.Status != 0 {
+		attrs = append(attrs, slog.Int("status", se.Status))
+	}
+	if se.Type != "" {
+		attrs = append(attrs, slog.String("type", se.Type))
+	}
+	if se.Detail != "" {
+		attrs = append(attrs, slog.String("detail", se.Detail))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (a Attr) slogAttr() slog.Attr {
+	switch v := a.Value.(type) {
+	case string:
+		return slog.String(a.Key, v)
+	case int64:
+		return slog.Int64(a.Key, v)
+	case float64:
+		return slog.Float64(a.Key, v)
+	case bool:
+		return slog.Bool(a.Key, v)
+	}
+	return slog.Any(a.Key, a.Value)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	var keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SlogOption configures SlogHandler.
+type SlogOption struct {
+	// when set, errors in records at or above ReportLevel are saved by Reporter,
+	// with the record's message, level and other attrs as context
+	Reporter *Reporter
+	// default slog.LevelError
+	ReportLevel slog.Leveler
+}
+
+// SlogHandler wraps a slog.Handler, expands errors wrapping an errorx error into groups, see Error.LogValue,
+// and optionally reports them.
+//
+//	logger := slog.New(errorx.NewSlogHandler(slog.NewJSONHandler(os.Stdout, nil), errorx.SlogOption{Reporter: rp}))
+//	logger.Error("pay fail", "err", fmt.Errorf("pay: %w", e))
+type SlogHandler struct {
+	next slog.Handler
+	opt  SlogOption
+
+	// errors and attrs added by WithAttrs, reported with records
+	errs   []error
+	attrs  map[string]interface{}
+	groups []string
+}
+
+func NewSlogHandler(next slog.Handler, opt SlogOption) *SlogHandler {
+	if opt.ReportLevel == nil {
+		opt.ReportLevel = slog.LevelError
+	}
+	return &SlogHandler{
+		next: next,
+		opt:  opt,
+	}
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var (
+		report = h.opt.Reporter != nil && r.Level >= h.opt.ReportLevel.Level()
+		errs   []error
+		values map[string]interface{}
+	)
+	if report {
+		errs = append(errs, h.errs...)
+		values = make(map[string]interface{}, len(h.attrs)+r.NumAttrs()+2)
+		for k, v := range h.attrs {
+			values[k] = v
+		}
+	}
+
+	rs := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		expanded, es := expandSlogAttr(a)
+		rs.AddAttrs(expanded)
+		if report {
+			errs = append(errs, es...)
+			collectSlogAttr(values, h.prefix(), a)
+		}
+		return true
+	})
+
+	er := h.next.Handle(ctx, rs)
+
+	if report && len(errs) != 0 {
+		values["log_message"] = r.Message
+		values["log_level"] = r.Level.String()
+		for _, e := range errs {
+			context := make(map[string]interface{}, len(values))
+			for k, v := range values {
+				context[k] = v
+			}
+			h.opt.Reporter.SaveError(Wrap(e), context)
+		}
+	}
+	return er
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := h.clone()
+	clone.attrs = make(map[string]interface{}, len(h.attrs)+len(attrs))
+	for k, v := range h.attrs {
+		clone.attrs[k] = v
+	}
+
+	var expanded = make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		v, es := expandSlogAttr(a)
+		expanded = append(expanded, v)
+		clone.errs = append(clone.errs, es...)
+		collectSlogAttr(clone.attrs, h.prefix(), a)
+	}
+	clone.next = h.next.WithAttrs(expanded)
+	return clone
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := h.clone()
+	clone.groups = append(append([]string(nil), h.groups...), name)
+	clone.next = h.next.WithGroup(name)
+	return clone
+}
+
+func (h *SlogHandler) clone() *SlogHandler {
+	return &SlogHandler{
+		next:   h.next,
+		opt:    h.opt,
+		errs:   append([]error(nil), h.errs...),
+		attrs:  h.attrs,
+		groups: h.groups,
+	}
+}
+
+func (h *SlogHandler) prefix() string {
+	var rs string
+	for _, v := range h.groups {
+		rs += v + "."
+	}
+	return rs
+}
+
+// expandSlogAttr replaces errors wrapping an errorx error with the group of the Error or ServiceError they wrap,
+// and returns all errors found in a.
+func expandSlogAttr(a slog.Attr) (slog.Attr, []error) {
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		var (
+			group = a.Value.Group()
+			rs    = make([]slog.Attr, 0, len(group))
+			errs  []error
+		)
+		for _, v := range group {
+			v, es := expandSlogAttr(v)
+			rs = append(rs, v)
+			errs = append(errs, es...)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(rs...)}, errs
+	case slog.KindAny, slog.KindLogValuer:
+		e, ok := a.Value.Any().(error)
+		if !ok || e == nil {
+			return a, nil
+		}
+		var x Error
+		if errors.As(e, &x) {
+			value := x.LogValue()
+			if _, isX := e.(Error); !isX {
+				// keep the message of outer wrappers like fmt.Errorf("pay: %w", e)
+				value = slog.GroupValue(append([]slog.Attr{slog.String("error", e.Error())}, value.Group()...)...)
+			}
+			return slog.Attr{Key: a.Key, Value: value}, []error{e}
+		}
+		var se ServiceError
+		if errors.As(e, &se) {
+			return slog.Attr{Key: a.Key, Value: se.LogValue()}, []error{e}
+		}
+		return a, []error{e}
+	}
+	return a, nil
+}
+
+// collectSlogAttr puts a into m as key-values, keys of groups are joined by '.'. Errors are skipped.
+func collectSlogAttr(m map[string]interface{}, prefix string, a slog.Attr) {
+	if k := a.Value.Kind(); k == slog.KindAny || k == slog.KindLogValuer {
+		if _, ok := a.Value.Any().(error); ok {
+			return
+		}
+	}
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, v := range a.Value.Group() {
+			collectSlogAttr(m, prefix, v)
+		}
+		return
+	}
+	m[prefix+a.Key] = a.Value.Any()
+}
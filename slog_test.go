@@ -0,0 +1,79 @@
+package errorx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+func TestLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	e := WrapAttrs(NewServiceError("balance not enough", 10001), Int("user_id", 1))
+	logger.Error("pay fail", "err", e)
+
+	var tmp struct {
+		Err struct {
+			Msg     string           `json:"msg"`
+			Errcode int              `json:"errcode"`
+			Stack   []string         `json:"stack"`
+			Attrs   map[string]int64 `json:"attrs"`
+		} `json:"err"`
+	}
+	if er := json.Unmarshal(buf.Bytes(), &tmp); er != nil || tmp.Err.Msg != "balance not enough" || tmp.Err.Errcode != 10001 ||
+		len(tmp.Err.Stack) != 1 || tmp.Err.Attrs["user_id"] != 1 {
+		fmt.Println(buf.String())
+		t.Fail()
+		return
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	var (
+		saved   []error
+		context map[string]interface{}
+	)
+	rp := NewReporter("test")
+	rp.AddModeHandler("test", func(e error, ctx map[string]interface{}) {
+		saved = append(saved, e)
+		context = ctx
+	})
+
+	var buf bytes.Buffer
+	logger := slog.New(NewSlogHandler(slog.NewJSONHandler(&buf, nil), SlogOption{Reporter: rp}))
+	logger = logger.With("api", "/pay")
+
+	e := fmt.Errorf("pay: %w", NewFromString("nil return"))
+	logger.WithGroup("req").Error("pay fail", "err", e, "user_id", 1)
+
+	var tmp struct {
+		Req struct {
+			Err struct {
+				Error string `json:"error"`
+				Msg   string `json:"msg"`
+			} `json:"err"`
+		} `json:"req"`
+	}
+	if er := json.Unmarshal(buf.Bytes(), &tmp); er != nil || tmp.Req.Err.Error != "pay: nil return" || tmp.Req.Err.Msg != "nil return" {
+		fmt.Println(buf.String())
+		t.Fail()
+		return
+	}
+
+	if len(saved) != 1 || context["log_message"] != "pay fail" || context["api"] != "/pay" || context["req.user_id"] != int64(1) {
+		fmt.Println(saved, context)
+		t.Fail()
+		return
+	}
+
+	// below ReportLevel
+	logger.Warn("pay slow", "err", e)
+	if len(saved) != 1 {
+		fmt.Println(saved)
+		t.Fail()
+		return
+	}
+}
@@ -36,13 +36,123 @@ func stackV2() string {
 	rs := fmt.Sprintf("%s %s", time.Now().Format("2006/1/2 15:04:05.000"), fmt.Sprintf("%s:%d", f, l))
 	return rs
 }
-func stackDepth3() string {
-	_, f, l, _ := runtime.Caller(3)
-	rs := fmt.Sprintf("%s %s", time.Now().Format("2006/1/2 15:04:05.000"), fmt.Sprintf("%s:%d", f, l))
+func stackDepth3(flag int) stackline {
+	pc, f, l, _ := runtime.Caller(3)
+	return stackline{
+		trace: formatTrace(flag, f, l),
+		pc:    pc,
+		file:  f,
+		line:  l,
+	}
+}
+
+// formatTrace formats the trace part of a stack line by flag
+func formatTrace(flag int, file string, line int) string {
+	var rs = make([]string, 0, 2)
+	if flag&LdateTime > 0 {
+		rs = append(rs, time.Now().Format("2006/1/2 15:04:05.000"))
+	}
+	if flag&Llongfile > 0 {
+		rs = append(rs, fmt.Sprintf("%s:%d", file, line))
+	}
+	return strings.Join(rs, " ")
+}
+
+// frames a call stack recorded by Lfullstack usually fits in, the buffer grows for deeper ones
+const stackDepth = 32
+
+// callers records program counters of the whole call stack of the current goroutine without resolving them.
+// skip follows runtime.Callers, 0 means callers itself's caller runtime.Callers.
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, stackDepth)
+	for {
+		n := runtime.Callers(skip, pcs)
+		if n < len(pcs) {
+			return pcs[:n:n]
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+}
+
+// Frame is a resolved frame of the call stack recorded by Lfullstack.
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line)
+}
+
+// StackFrames resolves the call stack recorded when e was created.
+// It returns nil if e is created without Lfullstack.
+func (e Error) StackFrames() []Frame {
+	if len(e.pcs) == 0 {
+		// frames decoded from json
+		return e.frames
+	}
+
+	var rs = make([]Frame, 0, len(e.pcs))
+	frames := runtime.CallersFrames(e.pcs)
+	for {
+		f, more := frames.Next()
+		rs = append(rs, Frame{
+			Function: f.Function,
+			File:     f.File,
+			Line:     f.Line,
+		})
+		if !more {
+			break
+		}
+	}
 	return rs
 }
 
+// formatFrames formats frames like a goroutine trace in panic
+func formatFrames(frames []Frame) string {
+	var buf strings.Builder
+	for _, f := range frames {
+		fmt.Fprintf(&buf, "%s()\n\t%s:%d\n", f.Function, f.File, f.Line)
+	}
+	return buf.String()
+}
+
 type stackline struct {
 	trace string
 	desc  string
+
+	// remote is the service name the line comes from, empty means local
+	remote string
+
+	// where the line is made, set by wrapStackLine or decoded from json, used by fingerprint
+	pc   uintptr
+	fn   string
+	file string
+	line int
+
+	// typed attributes of the layer, see WrapAttrs
+	attrs []Attr
+	// attrs are rendered into desc as well, by WrapContext, Error() doesn't print them again
+	described bool
+}
+
+// function returns the name of the function making the line
+func (s stackline) function() string {
+	if s.fn != "" || s.pc == 0 {
+		return s.fn
+	}
+	f, _ := runtime.CallersFrames([]uintptr{s.pc}).Next()
+	return f.Function
+}
+
+func (s stackline) String() string {
+	var rs = s.desc
+	if s.trace != "" {
+		rs = fmt.Sprintf("%s %s", s.trace, s.desc)
+	}
+	if s.remote != "" {
+		rs = fmt.Sprintf("[remote %s] %s", s.remote, rs)
+	}
+	return rs
 }
@@ -1 +1,79 @@
 package errorx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewWithStack(t *testing.T) {
+	e := NewWithStack(fmt.Errorf("connect to mysql time out")).(Error)
+
+	frames := e.StackFrames()
+	if len(frames) == 0 {
+		fmt.Println("frames should be recorded")
+		t.Fail()
+		return
+	}
+	if !strings.HasSuffix(frames[0].Function, "TestNewWithStack") {
+		fmt.Println(frames[0])
+		t.Fail()
+		return
+	}
+	fmt.Println(e.Error())
+}
+
+func TestLfullstack(t *testing.T) {
+	old := Flags()
+	defer SetFlags(old)
+
+	SetFlags(Llongfile | Lfullstack)
+	e := Wrap(fullstackService()).(Error)
+
+	frames := e.StackFrames()
+	if len(frames) < 2 || !strings.HasSuffix(frames[0].Function, "fullstackService") {
+		fmt.Println(frames)
+		t.Fail()
+		return
+	}
+	// wrapping should not reset the recorded stack
+	if len(e.Stack()) != 2+len(frames) {
+		fmt.Println(e.Stack())
+		t.Fail()
+		return
+	}
+
+	SetFlags(old)
+	if len(Wrap(fullstackService()).(Error).StackFrames()) != 0 {
+		t.Fail()
+		return
+	}
+}
+
+func fullstackService() error {
+	return NewFromString("nil return")
+}
+
+func TestNewWithStackDeep(t *testing.T) {
+	e := deepStack(100).(Error)
+
+	var n int
+	for _, f := range e.StackFrames() {
+		if strings.HasSuffix(f.Function, "deepStack") {
+			n++
+		}
+	}
+	// frames beyond the first 32 should be kept
+	if n != 101 {
+		fmt.Println(n)
+		t.Fail()
+		return
+	}
+}
+
+func deepStack(depth int) error {
+	if depth == 0 {
+		return NewWithStack(fmt.Errorf("deep"))
+	}
+	return deepStack(depth - 1)
+}